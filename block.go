@@ -0,0 +1,126 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Rhymen/go-whatsapp/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseBlocklistJson parses the json message of the form ["Blocklist", {"id": ..., "blocklist": [...]}] WhatsApp
+// sends after login and whenever the block list changed.
+func parseBlocklistJson(msg string) ([]string, bool) {
+	if !strings.HasPrefix(msg, `["Blocklist"`) {
+		return nil, false
+	}
+
+	var data []json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &data); err != nil || len(data) < 2 {
+		return nil, false
+	}
+
+	var blocklist struct {
+		Blocklist []string `json:"blocklist"`
+	}
+	if err := json.Unmarshal(data[1], &blocklist); err != nil {
+		return nil, false
+	}
+	return blocklist.Blocklist, true
+}
+
+/*
+BlockContact blocks the user jid. Blocking a contact that is already blocked does nothing.
+*/
+func (wac *Conn) BlockContact(jid string) error {
+	if wac.Store.isBlocked(jid) {
+		return nil
+	}
+	return wac.setBlocked(jid, true)
+}
+
+/*
+UnblockContact unblocks the user jid. Unblocking a contact that is not blocked does nothing.
+*/
+func (wac *Conn) UnblockContact(jid string) error {
+	if !wac.Store.isBlocked(jid) {
+		return nil
+	}
+	return wac.setBlocked(jid, false)
+}
+
+/*
+GetBlockedContacts returns the sorted JIDs of the blocked users. The block list is sent by WhatsApp after login and
+kept up to date afterwards, it is empty before login.
+*/
+func (wac *Conn) GetBlockedContacts() ([]string, error) {
+	if !wac.IsLoggedIn() {
+		return nil, ErrNotConnected
+	}
+
+	jids := wac.Store.getBlocklist()
+	sort.Strings(jids)
+	return jids, nil
+}
+
+func (wac *Conn) setBlocked(jid string, blocked bool) error {
+	if !wac.IsLoggedIn() {
+		return ErrNotConnected
+	}
+
+	// the block list still uses the legacy user server
+	if strings.HasSuffix(jid, "@"+userServer) {
+		jid = strings.TrimSuffix(jid, userServer) + legacyUserServer
+	}
+
+	action := "remove"
+	if blocked {
+		action = "add"
+	}
+
+	ts := time.Now().Unix()
+	tag := fmt.Sprintf("%d.--%d", ts, wac.msgCount)
+
+	n := binary.Node{
+		Description: "action",
+		Attributes: map[string]string{
+			"type":  "set",
+			"epoch": strconv.Itoa(wac.msgCount),
+		},
+		Content: []interface{}{binary.Node{
+			Description: "block",
+			Attributes: map[string]string{
+				"type": action,
+			},
+			Content: []binary.Node{{
+				Description: "user",
+				Attributes: map[string]string{
+					"jid": jid,
+				},
+			}},
+		}},
+	}
+
+	ch, err := wac.writeBinary(n, contact, ignore, tag)
+	if err != nil {
+		return fmt.Errorf("error sending block action: %v", err)
+	}
+
+	select {
+	case r := <-ch:
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &resp); err != nil {
+			return fmt.Errorf("error decoding block response: %v", err)
+		}
+		if status, ok := resp["status"].(float64); ok && int(status) != 200 {
+			return fmt.Errorf("block action responded with %d", int(status))
+		}
+	case <-time.After(wac.msgTimeout):
+		return fmt.Errorf("block action timed out")
+	}
+
+	wac.Store.setBlocked(jid, blocked)
+	return nil
+}
@@ -0,0 +1,55 @@
+package whatsapp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBlocklistJson(t *testing.T) {
+	blocklist, ok := parseBlocklistJson(`["Blocklist",{"id":1,"blocklist":["491234567890@c.us","491111111111@c.us"]}]`)
+	if !ok || !reflect.DeepEqual(blocklist, []string{"491234567890@c.us", "491111111111@c.us"}) {
+		t.Errorf("unexpected block list %q", blocklist)
+	}
+
+	if blocklist, ok := parseBlocklistJson(`["Blocklist",{"id":2,"blocklist":[]}]`); !ok || len(blocklist) != 0 {
+		t.Errorf("unexpected empty block list %q", blocklist)
+	}
+
+	for _, msg := range []string{`["Msg",{"cmd":"ack"}]`, `["Blocklist"`, `["Blocklist",{"blocklist":"491234567890@c.us"}]`} {
+		if blocklist, ok := parseBlocklistJson(msg); ok {
+			t.Errorf("parsed %s as %q", msg, blocklist)
+		}
+	}
+}
+
+func TestBlockContactIdempotent(t *testing.T) {
+	wac := &Conn{Store: newStore()}
+	wac.Store.setBlocklist([]string{"491234567890@c.us"})
+
+	// the block list uses the legacy server, both forms refer to the same user
+	if !wac.Store.isBlocked("491234567890@s.whatsapp.net") {
+		t.Fatal("contact of the block list not blocked")
+	}
+
+	// nothing is sent for contacts that already have the requested state, so it works without connection
+	if err := wac.BlockContact("491234567890@s.whatsapp.net"); err != nil {
+		t.Errorf("blocking a blocked contact: %v", err)
+	}
+	if err := wac.UnblockContact("491111111111@s.whatsapp.net"); err != nil {
+		t.Errorf("unblocking a contact that is not blocked: %v", err)
+	}
+	if err := wac.BlockContact("491111111111@s.whatsapp.net"); err != ErrNotConnected {
+		t.Errorf("blocking a new contact did not try to send: %v", err)
+	}
+
+	wac.Store.setBlocked("491111111111@c.us", true)
+	wac.Store.setBlocked("491111111111@s.whatsapp.net", true)
+	if blocklist := wac.Store.getBlocklist(); len(blocklist) != 2 {
+		t.Errorf("unexpected block list %q", blocklist)
+	}
+	wac.Store.setBlocked("491111111111@s.whatsapp.net", false)
+	wac.Store.setBlocked("491111111111@s.whatsapp.net", false)
+	if blocklist := wac.Store.getBlocklist(); !reflect.DeepEqual(blocklist, []string{"491234567890@s.whatsapp.net"}) {
+		t.Errorf("unexpected block list %q", blocklist)
+	}
+}
@@ -0,0 +1,128 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"strconv"
+	"strings"
+)
+
+type CallStatus string
+
+const (
+	CallOffer     CallStatus = "offer"
+	CallAccept    CallStatus = "accept"
+	CallReject    CallStatus = "reject"
+	CallTerminate CallStatus = "terminate"
+	CallTimeout   CallStatus = "timeout"
+)
+
+/*
+CallEvent represents a voice or video call of another user to the current account. WhatsApp Web can not take calls,
+the events are only informational. Calls are reported by the "Call" json messages of WhatsApp Web. A call that ended
+without being taken is reported with CallTimeout status, other ended calls with CallTerminate. Missed calls are
+additionally reported by a call message in the chat, which is dispatched as CallEvent with CallTimeout status.
+*/
+type CallEvent struct {
+	From      string
+	CallID    string
+	IsVideo   bool
+	Timestamp uint64
+	Status    CallStatus
+}
+
+// parseCallJson parses a json message of the form ["Call", {"id": ..., "from": ..., "data": [node]}]. The data is a
+// binary node in json form, [tag, attributes, children], whose tag is the call status, e.g.
+//
+//	["Call",{"id":"1","from":"491234567890@c.us","data":[["offer",{"call-creator":"491234567890@c.us","call-id":"ABC"},
+//		[["audio",{"enc":"opus","rate":"16000"},null],["video",{"enc":"vp8"},null]]]]}]
+func parseCallJson(msg string) (CallEvent, bool) {
+	if !strings.HasPrefix(msg, `["Call"`) {
+		return CallEvent{}, false
+	}
+
+	var data []json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &data); err != nil || len(data) < 2 {
+		return CallEvent{}, false
+	}
+
+	var call struct {
+		Id   string              `json:"id"`
+		From string              `json:"from"`
+		Data [][]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data[1], &call); err != nil || len(call.Data) == 0 {
+		return CallEvent{}, false
+	}
+
+	tag, attrs, children, ok := parseJsonNode(call.Data[0])
+	if !ok {
+		return CallEvent{}, false
+	}
+
+	event := CallEvent{
+		From:   call.From,
+		CallID: attrs["call-id"],
+		Status: CallStatus(tag),
+	}
+	if creator := attrs["call-creator"]; creator != "" {
+		event.From = creator
+	}
+	event.From = normalizeJid(event.From)
+	if event.CallID == "" {
+		event.CallID = call.Id
+	}
+	if event.Status == CallTerminate && attrs["reason"] == "timeout" {
+		event.Status = CallTimeout
+	}
+	if t, err := strconv.ParseUint(attrs["t"], 10, 64); err == nil {
+		event.Timestamp = t
+	}
+	for _, child := range children {
+		if tag, _, _, ok := parseJsonNode(child); ok && tag == "video" {
+			event.IsVideo = true
+		}
+	}
+
+	if event.CallID == "" || event.Status == "" {
+		return CallEvent{}, false
+	}
+	return event, true
+}
+
+// parseJsonNode parses a binary node in json form, [tag, attributes, children]. Attributes and children may be null.
+func parseJsonNode(node []json.RawMessage) (tag string, attrs map[string]string, children [][]json.RawMessage, ok bool) {
+	if len(node) == 0 || json.Unmarshal(node[0], &tag) != nil {
+		return "", nil, nil, false
+	}
+	if len(node) > 1 && json.Unmarshal(node[1], &attrs) != nil {
+		return "", nil, nil, false
+	}
+	if len(node) > 2 {
+		// children can also be text content, which is ignored
+		json.Unmarshal(node[2], &children)
+	}
+	return tag, attrs, children, true
+}
+
+// getMissedCall returns the CallEvent for the call messages WhatsApp adds to a chat for missed calls.
+func getMissedCall(msg *proto.WebMessageInfo) (CallEvent, bool) {
+	switch msg.GetMessageStubType() {
+	case proto.WebMessageInfo_CALL_MISSED_VOICE, proto.WebMessageInfo_CALL_MISSED_VIDEO:
+	default:
+		return CallEvent{}, false
+	}
+
+	from := msg.GetKey().GetParticipant()
+	if from == "" {
+		from = msg.GetKey().GetRemoteJid()
+	}
+
+	return CallEvent{
+		From:      normalizeJid(from),
+		CallID:    msg.GetKey().GetId(),
+		IsVideo:   msg.GetMessageStubType() == proto.WebMessageInfo_CALL_MISSED_VIDEO,
+		Timestamp: msg.GetMessageTimestamp(),
+		Status:    CallTimeout,
+	}, true
+}
@@ -0,0 +1,68 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"testing"
+)
+
+func TestParseCallJson(t *testing.T) {
+	for _, tc := range []struct {
+		msg  string
+		call CallEvent
+	}{
+		{
+			`["Call",{"id":"1588000000-1","from":"491234567890@c.us","data":[["offer",{"call-creator":"491234567890@c.us","call-id":"A8E1F0C2","device_class":"2012"},[["audio",{"enc":"opus","rate":"16000"},null],["audio",{"enc":"opus","rate":"8000"},null],["net",{"medium":"3"},null],["encopt",{"keygen":"2"},null]]]]}]`,
+			CallEvent{From: "491234567890@s.whatsapp.net", CallID: "A8E1F0C2", Status: CallOffer},
+		},
+		{
+			`["Call",{"id":"1588000000-2","from":"491234567890@c.us","data":[["offer",{"call-creator":"491234567890@c.us","call-id":"B7D2","device_class":"2012"},[["audio",{"enc":"opus","rate":"16000"},null],["video",{"enc":"vp8","dec":"vp8"},null],["net",{"medium":"3"},null]]]]}]`,
+			CallEvent{From: "491234567890@s.whatsapp.net", CallID: "B7D2", IsVideo: true, Status: CallOffer},
+		},
+		{
+			`["Call",{"id":"1588000000-3","from":"491234567890@c.us","data":[["terminate",{"call-creator":"491234567890@c.us","call-id":"A8E1F0C2","reason":"timeout"},null]]}]`,
+			CallEvent{From: "491234567890@s.whatsapp.net", CallID: "A8E1F0C2", Status: CallTimeout},
+		},
+		{
+			`["Call",{"id":"1588000000-4","from":"491234567890@c.us","data":[["terminate",{"call-creator":"491234567890@c.us","call-id":"A8E1F0C2"},null]]}]`,
+			CallEvent{From: "491234567890@s.whatsapp.net", CallID: "A8E1F0C2", Status: CallTerminate},
+		},
+		{
+			`["Call",{"id":"1588000000-5","from":"491234567890@c.us","data":[["reject",{"call-id":"C9"},null]]}]`,
+			CallEvent{From: "491234567890@s.whatsapp.net", CallID: "C9", Status: CallReject},
+		},
+	} {
+		call, ok := parseCallJson(tc.msg)
+		if !ok || call != tc.call {
+			t.Errorf("parsed %s as %+v, expected %+v", tc.msg, call, tc.call)
+		}
+	}
+
+	for _, msg := range []string{
+		`["Msg",{"cmd":"ack","id":"1"}]`,
+		`["Call",{"id":"1","from":"491234567890@c.us"}]`,
+		`["Call",{"id":"1","from":"491234567890@c.us","data":[[]]}]`,
+		`["Call"`,
+	} {
+		if call, ok := parseCallJson(msg); ok {
+			t.Errorf("parsed %s as %+v", msg, call)
+		}
+	}
+}
+
+func TestGetMissedCall(t *testing.T) {
+	remoteJid, id, ts := "491234567890@c.us", "MISSED", uint64(1588000000)
+	stub := proto.WebMessageInfo_CALL_MISSED_VIDEO
+	call, ok := getMissedCall(&proto.WebMessageInfo{
+		Key:              &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		MessageTimestamp: &ts,
+		MessageStubType:  &stub,
+	})
+	expected := CallEvent{From: "491234567890@s.whatsapp.net", CallID: id, IsVideo: true, Timestamp: ts, Status: CallTimeout}
+	if !ok || call != expected {
+		t.Errorf("unexpected missed call %+v", call)
+	}
+
+	if _, ok := getMissedCall(&proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &remoteJid, Id: &id}}); ok {
+		t.Error("message without stub parsed as missed call")
+	}
+}
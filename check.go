@@ -0,0 +1,166 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ContactCheckResult is the result of CheckContacts for a single number. Jid is the JID of the WhatsApp account of the
+number, it is only set if the number has an account.
+*/
+type ContactCheckResult struct {
+	Exists bool
+	Jid    string
+}
+
+type contactCheck struct {
+	result  ContactCheckResult
+	expires time.Time
+}
+
+/*
+CheckContacts checks which of the given phone numbers have a WhatsApp account. Numbers are given in the formats
+accepted by NewUserJID or as JID. The result maps every given number to its result. WhatsApp Web checks one number per
+query, CheckContacts sends CheckContactsChunkSize queries at the same time and waits for their responses before the
+next chunk, which keeps bulk checks within the rate limits of the server. If CheckContactsCacheTTL is set, results are
+cached for that time and numbers checked before are not queried again. If a number is invalid or a query fails, the
+results of the other numbers are returned together with the first error.
+*/
+func (wac *Conn) CheckContacts(numbers []string) (map[string]ContactCheckResult, error) {
+	results := make(map[string]ContactCheckResult, len(numbers))
+
+	var firstErr error
+	var pending []string
+	jids := make(map[string]string, len(numbers))
+	for _, n := range numbers {
+		jid, err := contactCheckJid(n)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error checking %s: %v", n, err)
+			}
+			continue
+		}
+		jids[n] = jid
+
+		if r, ok := wac.getContactCheck(jid); ok {
+			results[n] = r
+		} else {
+			pending = append(pending, n)
+		}
+	}
+
+	chunkSize := wac.CheckContactsChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 50
+	}
+
+	var mutex sync.Mutex
+	for start := 0; start < len(pending); start += chunkSize {
+		end := start + chunkSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		var wg sync.WaitGroup
+		for _, n := range pending[start:end] {
+			wg.Add(1)
+			go func(n string) {
+				defer wg.Done()
+				r, err := wac.checkContact(jids[n])
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("error checking %s: %v", n, err)
+					}
+					return
+				}
+				results[n] = r
+			}(n)
+		}
+		wg.Wait()
+	}
+
+	return results, firstErr
+}
+
+// contactCheckJid returns the JID of a phone number in one of the formats accepted by CheckContacts. Phone numbers are
+// converted with NewUserJID, JIDs have to pass ValidateJID.
+func contactCheckJid(number string) (string, error) {
+	if strings.Contains(number, "@") {
+		if err := ValidateJID(number); err != nil {
+			return "", err
+		}
+		return normalizeJid(number), nil
+	}
+	return NewUserJID(number)
+}
+
+func (wac *Conn) checkContact(jid string) (ContactCheckResult, error) {
+	// the exist query still uses the legacy user server
+	ch, err := wac.Exist(strings.TrimSuffix(jid, userServer) + legacyUserServer)
+	if err != nil {
+		return ContactCheckResult{}, err
+	}
+
+	var r string
+	select {
+	case r = <-ch:
+	case <-time.After(wac.msgTimeout):
+		return ContactCheckResult{}, fmt.Errorf("exist query timed out")
+	}
+
+	var resp struct {
+		Status int    `json:"status"`
+		Jid    string `json:"jid"`
+	}
+	if err := json.Unmarshal([]byte(r), &resp); err != nil {
+		return ContactCheckResult{}, fmt.Errorf("error decoding exist response: %v", err)
+	}
+
+	var result ContactCheckResult
+	switch resp.Status {
+	case 200:
+		result = ContactCheckResult{Exists: true, Jid: normalizeJid(resp.Jid)}
+		if result.Jid == "" {
+			result.Jid = jid
+		}
+	case 404:
+	default:
+		return ContactCheckResult{}, fmt.Errorf("exist query responded with %d", resp.Status)
+	}
+
+	wac.setContactCheck(jid, result)
+	return result, nil
+}
+
+func (wac *Conn) getContactCheck(jid string) (ContactCheckResult, bool) {
+	wac.contactChecksMutex.Lock()
+	defer wac.contactChecksMutex.Unlock()
+
+	c, ok := wac.contactChecks[jid]
+	if !ok || time.Now().After(c.expires) {
+		delete(wac.contactChecks, jid)
+		return ContactCheckResult{}, false
+	}
+	return c.result, true
+}
+
+func (wac *Conn) setContactCheck(jid string, result ContactCheckResult) {
+	if wac.CheckContactsCacheTTL <= 0 {
+		return
+	}
+
+	wac.contactChecksMutex.Lock()
+	defer wac.contactChecksMutex.Unlock()
+
+	if wac.contactChecks == nil {
+		wac.contactChecks = make(map[string]contactCheck)
+	}
+	wac.contactChecks[jid] = contactCheck{result, time.Now().Add(wac.CheckContactsCacheTTL)}
+}
@@ -0,0 +1,44 @@
+package whatsapp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContactCheckJid(t *testing.T) {
+	for number, jid := range map[string]string{
+		"+49 1234-567890":             "491234567890@s.whatsapp.net",
+		"491234567890":                "491234567890@s.whatsapp.net",
+		"491234567890@c.us":           "491234567890@s.whatsapp.net",
+		"491234567890@s.whatsapp.net": "491234567890@s.whatsapp.net",
+	} {
+		if got, err := contactCheckJid(number); err != nil || got != jid {
+			t.Errorf("%q converted to %q, %v", number, got, err)
+		}
+	}
+
+	for _, number := range []string{"(49) 1234567890", "+49 1234 5678 abc", "+49 123@s.whatsapp.net", "491234567890@example.com"} {
+		if jid, err := contactCheckJid(number); err == nil {
+			t.Errorf("invalid number %q converted to %q", number, jid)
+		}
+	}
+}
+
+func TestCheckContactsCache(t *testing.T) {
+	wac := &Conn{CheckContactsCacheTTL: time.Minute}
+	wac.setContactCheck("491234567890@s.whatsapp.net", ContactCheckResult{Exists: true, Jid: "491234567890@s.whatsapp.net"})
+
+	// served from the cache, a query would fail without connection
+	results, err := wac.CheckContacts([]string{"+49 1234567890"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results["+49 1234567890"]; !r.Exists {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	wac.contactChecks["491234567890@s.whatsapp.net"] = contactCheck{expires: time.Now().Add(-time.Second)}
+	if _, ok := wac.getContactCheck("491234567890@s.whatsapp.net"); ok {
+		t.Error("expired result returned")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Rhymen/go-whatsapp/binary"
@@ -19,6 +20,10 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+}
+
 type metric byte
 
 const (
@@ -83,16 +88,110 @@ type Conn struct {
 	wsConnOK       bool
 	wsConnMutex    sync.RWMutex
 	session        *Session
+	loggedIn       int32
 	listener       map[string]chan string
 	listenerMutex  sync.RWMutex
 	writeChan      chan wsMsg
 	handler        []Handler
+	handledKinds   map[MessageKind]bool
+	handlerMutex   sync.RWMutex
 	msgCount       int
 	msgTimeout     time.Duration
+	orderedSends   bool
+	sendQueue      map[string]chan struct{}
+	sendQueueMutex sync.Mutex
+	inFlightSends  int32
+	inFlightSem    chan struct{}
+	inFlightFast   bool
+	inFlightMutex  sync.Mutex
 	Info           *Info
 	Store          *Store
 	ServerLastSeen time.Time
 
+	// MaxImageDimension is the maximum width and height of images sent with Send. Larger images are scaled down,
+	// keeping their aspect ratio, and sent in their original format, so png images keep their transparency. Images that
+	// fit are sent unchanged. Zero disables scaling.
+	MaxImageDimension int
+
+	// AutoPresence makes Send show the typing indicator in the chat before a TextMessage is sent. Send waits
+	// AutoPresenceDelay per character of the text, at most AutoPresenceMaxDelay, before sending the message and
+	// clears the indicator right after the message is written. Errors of the presence updates are passed to the
+	// handlers and do not fail the send. The delays default to 50ms and 5s.
+	AutoPresence         bool
+	AutoPresenceDelay    time.Duration
+	AutoPresenceMaxDelay time.Duration
+
+	// BlurThumbnails makes Send replace the thumbnails of images and videos with a small blurred version, which shows
+	// the colors of the media but no details until the recipient downloads it. Images sent without Thumbnail get a
+	// blurred thumbnail of their content. The media itself is sent unchanged.
+	BlurThumbnails bool
+
+	// StreamingUpload makes media uploads stream content that implements io.Seeker, e.g. an *os.File, instead of
+	// reading it into memory. WhatsApp requires the hash of the encrypted file before the upload starts, so streamed
+	// content is read and encrypted twice, which trades memory for time. The upload fails if the content changes in
+	// between. Other readers, and images scaled with MaxImageDimension or documents passed to the document thumbnailer,
+	// are still read into memory.
+	StreamingUpload bool
+
+	// MediaClient is the http client used for media uploads and for the media downloads and availability checks of the
+	// connection (DownloadMedia, DownloadMediaToWriter, DownloadEncryptedMedia and MediaAvailable), e.g. to route
+	// media traffic through a proxy or to set timeouts for media transfers independently of the websocket connection.
+	// If it is nil, http.DefaultClient is used. The package level download functions and the Download methods of the
+	// message types always use http.DefaultClient.
+	MediaClient *http.Client
+
+	// MediaUploadRetries is the number of times a media upload is retried after network errors or server errors
+	// (5xx) of the media servers, with exponential backoff starting at one second. Client errors (4xx) are not
+	// retried. NewConn sets it to 2.
+	MediaUploadRetries int
+
+	// MaxMediaSize is the maximum file length in bytes of media downloaded with DownloadMedia. Larger media is
+	// rejected before anything is downloaded or allocated, and downloads are aborted as soon as the server sends more
+	// than the announced file length. NewConn sets it to DefaultMaxMediaSize, zero disables the limit.
+	MaxMediaSize int64
+
+	// MaxTimestampLead is the maximum time the timestamps of sent messages run ahead of the clock. Send gives every
+	// message a timestamp after the previous one, so a burst of more than one message per second runs ahead of the
+	// clock; once the lead is reached, Send waits until the clock catches up. It defaults to one minute.
+	MaxTimestampLead time.Duration
+
+	// CheckContactsChunkSize is the number of numbers CheckContacts queries at the same time, it defaults to 50.
+	// CheckContactsCacheTTL is the time CheckContacts caches results, zero disables the cache, which is the default.
+	CheckContactsChunkSize int
+	CheckContactsCacheTTL  time.Duration
+
+	// DeviceJid is set as participant in the key of every message sent with Send that does not have a participant
+	// yet. By default it is empty and the phone fills in the sender, which is correct as long as the connection is
+	// the WhatsApp Web session of the phone. Set it only if the messages are sent on behalf of a specific device,
+	// e.g. when running as a companion device behind a relay that expects the device in the key.
+	DeviceJid string
+
+	// MessageIDGenerator generates the ids of messages that are sent without id, e.g. to add a tag of the client for
+	// deduplication. The ids have to be unique, the WhatsApp clients use uppercase hex digits. If it is nil, ids of
+	// 10 random bytes from crypto/rand are generated in the format set with SetMessageIdFormat.
+	MessageIDGenerator func() string
+
+	// PushName is the display name sent with every message that does not have Info.PushName set. Recipients, in
+	// particular the other participants of groups, show it for senders that are not in their contacts. Login sets it
+	// to the name of the account if it is empty. Messages are sent without push name while it is empty.
+	PushName string
+
+	documentThumbnailer DocumentThumbnailer
+	sendMiddleware      []SendMiddleware
+	receiveMiddleware   []ReceiveMiddleware
+	middlewareMutex     sync.RWMutex
+	messageIdPrefix     string
+	messageIdBytes      int
+	messageIdMutex      sync.RWMutex
+	outbox              Outbox
+	outboxMutex         sync.RWMutex
+	contactChecks       map[string]contactCheck
+	contactChecksMutex  sync.Mutex
+	privacySettings     PrivacySettings
+	privacyMutex        sync.RWMutex
+	lastTimestamp       uint64
+	timestampMutex      sync.Mutex
+
 	longClientName  string
 	shortClientName string
 }
@@ -118,6 +217,12 @@ func NewConn(timeout time.Duration) (*Conn, error) {
 		msgTimeout:    timeout,
 		Store:         newStore(),
 
+		AutoPresenceDelay:      50 * time.Millisecond,
+		AutoPresenceMaxDelay:   5 * time.Second,
+		CheckContactsChunkSize: 50,
+		MediaUploadRetries:     2,
+		MaxMediaSize:           DefaultMaxMediaSize,
+
 		longClientName:  "github.com/rhymen/go-whatsapp",
 		shortClientName: "go-whatsapp",
 	}
@@ -133,15 +238,45 @@ func NewConn(timeout time.Duration) (*Conn, error) {
 	return wac, nil
 }
 
+/*
+IsConnected reports whether the websocket connection to the WhatsAppWeb servers is currently established. It does not
+tell whether the connection is logged in, see IsLoggedIn.
+*/
+func (wac *Conn) IsConnected() bool {
+	wac.wsConnMutex.RLock()
+	defer wac.wsConnMutex.RUnlock()
+	return wac.wsConn != nil && wac.wsConnOK
+}
+
+/*
+IsLoggedIn reports whether Login or RestoreSession succeeded on this connection and no Logout happened since. Messages
+can only be sent while logged in.
+*/
+func (wac *Conn) IsLoggedIn() bool {
+	return atomic.LoadInt32(&wac.loggedIn) == 1
+}
+
+// setLoggedIn sets the login state IsLoggedIn reports. It is read by every Send, so it is accessed atomically.
+func (wac *Conn) setLoggedIn(loggedIn bool) {
+	var v int32
+	if loggedIn {
+		v = 1
+	}
+	atomic.StoreInt32(&wac.loggedIn, v)
+}
+
+// isConnected is IsConnected for reconnect loops, it sends a keepalive to test established connections that are not
+// known to be OK.
 func (wac *Conn) isConnected() bool {
+	if wac.IsConnected() {
+		return true
+	}
+
 	wac.wsConnMutex.RLock()
 	defer wac.wsConnMutex.RUnlock()
 	if wac.wsConn == nil {
 		return false
 	}
-	if wac.wsConnOK {
-		return true
-	}
 
 	// just send a keepalive to test the connection
 	wac.sendKeepAlive()
@@ -314,7 +449,7 @@ func (wac *Conn) readPump() {
 			wac.dispatch(message)
 		} else {
 			if len(data[1]) > 0 {
-				wac.handle(string(data[1]))
+				wac.dispatch(string(data[1]))
 			}
 		}
 
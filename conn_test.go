@@ -0,0 +1,150 @@
+package whatsapp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/Rhymen/go-whatsapp/binary"
+	"github.com/Rhymen/go-whatsapp/crypto/cbc"
+	"github.com/gorilla/websocket"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFrame is a frame a Conn wrote to the websocket. Binary frames are decrypted into node, the json array of text
+// frames is decoded into json.
+type testFrame struct {
+	tag  string
+	node *binary.Node
+	json []interface{}
+}
+
+// testServer stands in for the WhatsApp Web servers. It reads the frames the Conn writes and answers them with the
+// result of respond, which is either a string sent as it is or a *binary.Node sent encrypted. Frames respond returns
+// nil for are not answered.
+type testServer struct {
+	t       *testing.T
+	wac     *Conn
+	respond func(f testFrame) interface{}
+	frames  []testFrame
+	mutex   sync.Mutex
+	done    chan struct{}
+}
+
+// newTestConn returns a logged in Conn that is connected to a testServer, which has to be closed after the test.
+func newTestConn(t *testing.T, respond func(f testFrame) interface{}) (*Conn, *testServer) {
+	wac := &Conn{
+		session: &Session{
+			EncKey: bytes.Repeat([]byte{1}, 32),
+			MacKey: bytes.Repeat([]byte{2}, 32),
+			Wid:    "491234567890@c.us",
+		},
+		listener:   make(map[string]chan string),
+		writeChan:  make(chan wsMsg, 16),
+		msgTimeout: time.Second,
+		Store:      newStore(),
+	}
+	wac.setLoggedIn(true)
+
+	s := &testServer{t: t, wac: wac, respond: respond, done: make(chan struct{})}
+	go s.serve()
+	return wac, s
+}
+
+// close stops the server.
+func (s *testServer) close() {
+	close(s.done)
+}
+
+func (s *testServer) serve() {
+	for {
+		select {
+		case msg := <-s.wac.writeChan:
+			s.receive(msg)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *testServer) receive(msg wsMsg) {
+	parts := bytes.SplitN(msg.data, []byte(","), 2)
+	f := testFrame{tag: string(parts[0])}
+	if msg.messageType == websocket.BinaryMessage {
+		// the metric and flag bytes precede the encrypted node
+		node, err := s.wac.decryptBinaryMessage(parts[1][2:])
+		if err != nil {
+			s.t.Errorf("error decrypting frame: %v", err)
+			return
+		}
+		f.node = node
+	} else if err := json.Unmarshal(parts[1], &f.json); err != nil {
+		s.t.Errorf("error decoding frame %s: %v", msg.data, err)
+		return
+	}
+
+	s.mutex.Lock()
+	s.frames = append(s.frames, f)
+	s.mutex.Unlock()
+
+	if s.respond == nil {
+		return
+	}
+	var data string
+	switch r := s.respond(f).(type) {
+	case string:
+		data = r
+	case *binary.Node:
+		data = string(s.encrypt(r))
+	default:
+		return
+	}
+
+	s.answer(f.tag, data)
+}
+
+// answer sends data as response to the frame with the tag tag.
+func (s *testServer) answer(tag, data string) {
+	s.wac.listenerMutex.Lock()
+	ch, ok := s.wac.listener[tag]
+	delete(s.wac.listener, tag)
+	s.wac.listenerMutex.Unlock()
+	if ok {
+		ch <- data
+	}
+}
+
+// waitFrames waits until the Conn wrote at least n frames and returns them.
+func (s *testServer) waitFrames(n int) []testFrame {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if frames := s.received(); len(frames) >= n {
+			return frames
+		}
+	}
+	s.t.Fatalf("got %d frames, expected %d", len(s.received()), n)
+	return nil
+}
+
+// encrypt encrypts node like the server does for binary frames.
+func (s *testServer) encrypt(node *binary.Node) []byte {
+	b, err := binary.Marshal(*node)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	cipher, err := cbc.Encrypt(s.wac.session.EncKey, nil, b)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	h := hmac.New(sha256.New, s.wac.session.MacKey)
+	h.Write(cipher)
+	return append(h.Sum(nil), cipher...)
+}
+
+// received returns the frames the Conn wrote so far.
+func (s *testServer) received() []testFrame {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]testFrame(nil), s.frames...)
+}
@@ -1,18 +1,22 @@
 package whatsapp
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Rhymen/go-whatsapp/binary"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Presence string
 
 const (
-	PresenceAvailable   = "available"
-	PresenceUnavailable = "unavailable"
-	PresenceComposing   = "composing"
+	PresenceAvailable   Presence = "available"
+	PresenceUnavailable Presence = "unavailable"
+	PresenceComposing   Presence = "composing"
+	PresenceRecording   Presence = "recording"
+	PresencePaused      Presence = "paused"
 )
 
 //TODO: filename? WhatsApp uses Store.Contacts for these functions
@@ -28,11 +32,55 @@ func (wac *Conn) GetStatus(jid string) (<-chan string, error) {
 	return wac.write(data)
 }
 
+func (wac *Conn) Exist(jid string) (<-chan string, error) {
+	data := []interface{}{"query", "exist", jid}
+	return wac.write(data)
+}
+
 func (wac *Conn) GetGroupMetaData(jid string) (<-chan string, error) {
 	data := []interface{}{"query", "GroupMetadata", jid}
 	return wac.write(data)
 }
 
+/*
+GetCommonGroups returns the jids of the groups the current user shares with the contact jid. WhatsApp Web has no query
+for common groups, so the groups in the chat list are checked one after another using their metadata. Groups whose
+metadata the server refuses to send (status 401 or 403, e.g. groups the user was removed from) are skipped. Any other
+error, like a timeout, stops the check and is returned.
+*/
+func (wac *Conn) GetCommonGroups(jid string) ([]string, error) {
+	chats, err := wac.Chats()
+	if err != nil {
+		return nil, fmt.Errorf("error querying chats: %v", err)
+	}
+
+	jid = normalizeJid(jid)
+	groups := make([]string, 0)
+
+	content, _ := chats.Content.([]interface{})
+	for _, c := range content {
+		chat, ok := c.(binary.Node)
+		if !ok || !strings.HasSuffix(chat.Attributes["jid"], "@"+groupServer) {
+			continue
+		}
+
+		meta, err := wac.getGroupMetaData(chat.Attributes["jid"])
+		if e, ok := err.(*groupStatusError); ok && (e.status == 401 || e.status == 403) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking group %s: %v", chat.Attributes["jid"], err)
+		}
+		for _, p := range meta.Participants {
+			if normalizeJid(p.Id) == jid {
+				groups = append(groups, chat.Attributes["jid"])
+				break
+			}
+		}
+	}
+
+	return groups, nil
+}
+
 func (wac *Conn) SubscribePresence(jid string) (<-chan string, error) {
 	data := []interface{}{"action", "presence", "subscribe", jid}
 	return wac.write(data)
@@ -46,6 +94,79 @@ func (wac *Conn) UpdateGroupSubject(subject string, jid string) (<-chan string,
 	return wac.setGroup("subject", jid, subject, nil)
 }
 
+/*
+SetGroupSubject changes the subject of the group with the given jid. Groups always have a subject, an empty subject is
+rejected. The current user has to be an admin of the group, otherwise an error is returned without sending the change.
+The call blocks until the server acknowledged the change.
+*/
+func (wac *Conn) SetGroupSubject(jid, subject string) error {
+	if strings.TrimSpace(subject) == "" {
+		return fmt.Errorf("group subject is empty")
+	}
+	if _, err := wac.getGroupMetaDataAsAdmin(jid); err != nil {
+		return err
+	}
+
+	ch, err := wac.setGroup("subject", jid, subject, nil)
+	if err != nil {
+		return fmt.Errorf("error writing group subject: %v", err)
+	}
+
+	return wac.waitGroupResponse(ch)
+}
+
+/*
+SetGroupDescription changes the description of the group with the given jid. The current user has to be an admin of
+the group. WhatsApp versions descriptions, every update has to reference the id of the description it replaces.
+This id is read from the group metadata before the update is sent.
+*/
+func (wac *Conn) SetGroupDescription(jid, description string) error {
+	meta, err := wac.getGroupMetaDataAsAdmin(jid)
+	if err != nil {
+		return err
+	}
+
+	prev := meta.DescId
+	if prev == "" {
+		prev = "none"
+	}
+
+	ts := time.Now().Unix()
+	tag := fmt.Sprintf("%d.--%d", ts, wac.msgCount)
+
+	n := binary.Node{
+		Description: "action",
+		Attributes: map[string]string{
+			"type":  "set",
+			"epoch": strconv.Itoa(wac.msgCount),
+		},
+		Content: []interface{}{binary.Node{
+			Description: "group",
+			Attributes: map[string]string{
+				"author": wac.session.Wid,
+				"id":     tag,
+				"type":   "description",
+				"jid":    jid,
+			},
+			Content: []binary.Node{{
+				Description: "description",
+				Attributes: map[string]string{
+					"id":   generateMessageId(),
+					"prev": prev,
+				},
+				Content: []byte(description),
+			}},
+		}},
+	}
+
+	ch, err := wac.writeBinary(n, group, ignore, tag)
+	if err != nil {
+		return fmt.Errorf("error writing group description: %v", err)
+	}
+
+	return wac.waitGroupResponse(ch)
+}
+
 func (wac *Conn) SetAdmin(jid string, participants []string) (<-chan string, error) {
 	return wac.setGroup("promote", jid, "", participants)
 }
@@ -86,6 +207,13 @@ func (wac *Conn) Presence(jid string, presence Presence) (<-chan string, error)
 	ts := time.Now().Unix()
 	tag := fmt.Sprintf("%d.--%d", ts, wac.msgCount)
 
+	attributes := map[string]string{
+		"type": string(presence),
+	}
+	if jid != "" {
+		attributes["to"] = jid
+	}
+
 	n := binary.Node{
 		Description: "action",
 		Attributes: map[string]string{
@@ -94,15 +222,45 @@ func (wac *Conn) Presence(jid string, presence Presence) (<-chan string, error)
 		},
 		Content: []interface{}{binary.Node{
 			Description: "presence",
-			Attributes: map[string]string{
-				"type": string(presence),
-			},
+			Attributes:  attributes,
 		}},
 	}
 
 	return wac.writeBinary(n, group, ignore, tag)
 }
 
+/*
+SendPresence sets the presence of the account like Presence and waits until the server acknowledged it. PresenceAvailable
+and PresenceUnavailable set the online state of the account, jid is ignored for them. PresenceComposing,
+PresenceRecording and PresencePaused are shown in the chat jid. The typing and recording indicators expire after a few
+seconds in the apps, callers that keep typing have to send them again periodically, e.g. every 10 seconds, and should
+send PresencePaused when they are done.
+*/
+func (wac *Conn) SendPresence(jid string, presence Presence) error {
+	if presence == PresenceAvailable || presence == PresenceUnavailable {
+		jid = ""
+	}
+
+	ch, err := wac.Presence(jid, presence)
+	if err != nil {
+		return fmt.Errorf("error sending presence: %v", err)
+	}
+
+	select {
+	case r := <-ch:
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &resp); err != nil {
+			return fmt.Errorf("error decoding presence response: %v", err)
+		}
+		if status, ok := resp["status"].(float64); ok && int(status) != 200 {
+			return fmt.Errorf("presence responded with %d", int(status))
+		}
+	case <-time.After(wac.msgTimeout):
+		return fmt.Errorf("sending presence timed out")
+	}
+	return nil
+}
+
 func (wac *Conn) Emoji() (*binary.Node, error) {
 	return wac.query("emoji", "", "", "", "", "", 0, 0)
 }
@@ -115,6 +273,12 @@ func (wac *Conn) Chats() (*binary.Node, error) {
 	return wac.query("chat", "", "", "", "", "", 0, 0)
 }
 
+/*
+Read marks the message id in the chat jid and all messages before it as read. If the account has read receipts
+disabled, the chat is still marked as read, but the sender does not get a read receipt. Read then returns the
+response channel together with ErrReadReceiptsDisabled. The setting is known after GetPrivacySettings or
+SetPrivacySetting was called, before that Read can not detect it.
+*/
 func (wac *Conn) Read(jid, id string) (<-chan string, error) {
 	ts := time.Now().Unix()
 	tag := fmt.Sprintf("%d.--%d", ts, wac.msgCount)
@@ -136,7 +300,11 @@ func (wac *Conn) Read(jid, id string) (<-chan string, error) {
 		}},
 	}
 
-	return wac.writeBinary(n, group, ignore, tag)
+	ch, err := wac.writeBinary(n, group, ignore, tag)
+	if err == nil && wac.readReceiptsDisabled() {
+		err = ErrReadReceiptsDisabled
+	}
+	return ch, err
 }
 
 func (wac *Conn) query(t, jid, messageId, kind, owner, search string, count, page int) (*binary.Node, error) {
@@ -248,3 +416,92 @@ func buildParticipantNodes(participants []string) []binary.Node {
 	}
 	return p
 }
+
+type groupMetaData struct {
+	Id           string `json:"id"`
+	Owner        string `json:"owner"`
+	Subject      string `json:"subject"`
+	Desc         string `json:"desc"`
+	DescId       string `json:"descId"`
+	Participants []struct {
+		Id           string `json:"id"`
+		IsAdmin      bool   `json:"isAdmin"`
+		IsSuperAdmin bool   `json:"isSuperAdmin"`
+	} `json:"participants"`
+}
+
+// groupStatusError is returned for group metadata requests the server answered with an error status.
+type groupStatusError struct {
+	status int
+}
+
+func (e *groupStatusError) Error() string {
+	return fmt.Sprintf("group metadata request responded with %d", e.status)
+}
+
+func (wac *Conn) getGroupMetaData(jid string) (*groupMetaData, error) {
+	ch, err := wac.GetGroupMetaData(jid)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting group metadata: %v", err)
+	}
+
+	var r string
+	select {
+	case r = <-ch:
+	case <-time.After(wac.msgTimeout):
+		return nil, fmt.Errorf("group metadata request timed out")
+	}
+
+	var resp struct {
+		Status *int `json:"status"`
+		groupMetaData
+	}
+	if err := json.Unmarshal([]byte(r), &resp); err != nil {
+		return nil, fmt.Errorf("error decoding group metadata: %v", err)
+	}
+	if resp.Status != nil && *resp.Status != 200 {
+		return nil, &groupStatusError{*resp.Status}
+	}
+
+	return &resp.groupMetaData, nil
+}
+
+func (wac *Conn) getGroupMetaDataAsAdmin(jid string) (*groupMetaData, error) {
+	if wac.session == nil {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	meta, err := wac.getGroupMetaData(jid)
+	if err != nil {
+		return nil, err
+	}
+
+	own := normalizeJid(wac.session.Wid)
+	for _, p := range meta.Participants {
+		if normalizeJid(p.Id) == own {
+			if p.IsAdmin || p.IsSuperAdmin {
+				return meta, nil
+			}
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("admin rights required to change group %s", jid)
+}
+
+func (wac *Conn) waitGroupResponse(ch <-chan string) error {
+	select {
+	case r := <-ch:
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &resp); err != nil {
+			return fmt.Errorf("error decoding group response: %v", err)
+		}
+		if status, ok := resp["status"].(float64); ok && int(status) != 200 {
+			return fmt.Errorf("group action responded with %d", int(status))
+		}
+	case <-time.After(wac.msgTimeout):
+		return fmt.Errorf("group action timed out")
+	}
+
+	return nil
+}
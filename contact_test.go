@@ -0,0 +1,137 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetCommonGroups(t *testing.T) {
+	metadata := map[string]string{
+		"1-1@g.us": `{"id":"1-1@g.us","participants":[{"id":"491111111111@c.us"},{"id":"491234567890@c.us"}]}`,
+		"2-2@g.us": `{"status":401}`,
+		"3-3@g.us": `{"id":"3-3@g.us","participants":[{"id":"492222222222@c.us"}]}`,
+		"4-4@g.us": `{"id":"4-4@g.us","participants":[{"id":"491111111111@s.whatsapp.net"}]}`,
+	}
+	respond := func(f testFrame) interface{} {
+		if f.node != nil {
+			var chats []interface{}
+			for _, jid := range []string{"1-1@g.us", "491111111111@c.us", "2-2@g.us", "3-3@g.us", "4-4@g.us"} {
+				chats = append(chats, binary.Node{Description: "chat", Attributes: map[string]string{"jid": jid}})
+			}
+			return &binary.Node{Description: "response", Attributes: map[string]string{"type": "chat"}, Content: chats}
+		}
+		if r, ok := metadata[f.json[2].(string)]; ok {
+			return r
+		}
+		return nil
+	}
+
+	wac, srv := newTestConn(t, respond)
+	defer srv.close()
+
+	groups, err := wac.GetCommonGroups("491111111111@s.whatsapp.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(groups, []string{"1-1@g.us", "4-4@g.us"}) {
+		t.Errorf("unexpected common groups %q", groups)
+	}
+
+	// errors other than a refused request are returned
+	metadata["3-3@g.us"] = `{"status":500}`
+	if _, err := wac.GetCommonGroups("491111111111@s.whatsapp.net"); err == nil || !strings.Contains(err.Error(), "3-3@g.us") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// childNodes returns the nodes in the content of n.
+func childNodes(n binary.Node) []binary.Node {
+	switch content := n.Content.(type) {
+	case []binary.Node:
+		return content
+	case []interface{}:
+		var nodes []binary.Node
+		for _, c := range content {
+			if child, ok := c.(binary.Node); ok {
+				nodes = append(nodes, child)
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+// groupChange returns the group node of the action node n.
+func groupChange(t *testing.T, n *binary.Node) binary.Node {
+	if n == nil || n.Description != "action" {
+		t.Fatalf("unexpected node %+v", n)
+	}
+	children := childNodes(*n)
+	if len(children) != 1 || children[0].Description != "group" {
+		t.Fatalf("unexpected content %+v", n.Content)
+	}
+	return children[0]
+}
+
+func TestSetGroupSubjectAndDescription(t *testing.T) {
+	metadata := `{"id":"1-1@g.us","descId":"DESC1","participants":[{"id":"491234567890@c.us","isAdmin":true}]}`
+	respond := func(f testFrame) interface{} {
+		if f.node != nil {
+			return `{"status":200}`
+		}
+		return metadata
+	}
+	wac, srv := newTestConn(t, respond)
+	defer srv.close()
+
+	if err := wac.SetGroupSubject("1-1@g.us", " "); err == nil {
+		t.Error("empty subject accepted")
+	}
+	if frames := srv.received(); len(frames) != 0 {
+		t.Errorf("empty subject sent %d frames", len(frames))
+	}
+
+	if err := wac.SetGroupSubject("1-1@g.us", "new subject"); err != nil {
+		t.Fatal(err)
+	}
+	frames := srv.received()
+	if len(frames) != 2 || frames[0].json[1] != "GroupMetadata" {
+		t.Fatalf("unexpected frames %+v", frames)
+	}
+	g := groupChange(t, frames[1].node)
+	if g.Attributes["type"] != "subject" || g.Attributes["subject"] != "new subject" || g.Attributes["jid"] != "1-1@g.us" {
+		t.Errorf("unexpected subject change %+v", g.Attributes)
+	}
+
+	for prev, descId := range map[string]string{"DESC1": `"descId":"DESC1",`, "none": ""} {
+		metadata = `{"id":"1-1@g.us",` + descId + `"participants":[{"id":"491234567890@c.us","isAdmin":true}]}`
+		if err := wac.SetGroupDescription("1-1@g.us", "new description"); err != nil {
+			t.Fatal(err)
+		}
+		frames = srv.received()
+		g = groupChange(t, frames[len(frames)-1].node)
+		children := childNodes(g)
+		if g.Attributes["type"] != "description" || len(children) != 1 {
+			t.Fatalf("unexpected description change %+v", g)
+		}
+		d := children[0]
+		if d.Attributes["prev"] != prev || d.Attributes["id"] == "" || string(d.Content.([]byte)) != "new description" {
+			t.Errorf("unexpected description node %+v", d)
+		}
+	}
+
+	// nothing is sent without admin rights
+	metadata = `{"id":"1-1@g.us","participants":[{"id":"491234567890@c.us"}]}`
+	sent := len(srv.received())
+	if err := wac.SetGroupSubject("1-1@g.us", "subject"); err == nil {
+		t.Error("subject changed without admin rights")
+	}
+	if err := wac.SetGroupDescription("1-1@g.us", "description"); err == nil {
+		t.Error("description changed without admin rights")
+	}
+	if frames := srv.received(); len(frames) != sent+2 {
+		t.Errorf("changes sent without admin rights: %+v", frames[sent:])
+	}
+}
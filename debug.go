@@ -0,0 +1,36 @@
+package whatsapp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	pb "github.com/golang/protobuf/proto"
+)
+
+/*
+DebugDump returns a readable representation of a message for bug reports and protocol debugging. For the message types
+of the package it contains the type, the parsed MessageInfo and the proto the message was parsed from (Info.Source) in
+protobuf text format, which only lists the fields that are set. A *proto.WebMessageInfo is dumped in text format
+directly. DebugDump is slow and meant for debugging only.
+*/
+func DebugDump(msg interface{}) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%T\n", msg)
+
+	var source *proto.WebMessageInfo
+	switch m := msg.(type) {
+	case *proto.WebMessageInfo:
+		source = m
+	case MessageInfoGetter:
+		info := m.GetInfo()
+		source, info.Source = info.Source, nil
+		fmt.Fprintf(&b, "info: %+v\n", info)
+	default:
+		fmt.Fprintf(&b, "%+v\n", msg)
+	}
+
+	if source != nil {
+		fmt.Fprintf(&b, "source:\n%s", pb.MarshalTextString(source))
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package whatsapp
+
+import "errors"
+
+var (
+	// ErrNotConnected is returned by Send if the connection is not logged in yet.
+	ErrNotConnected = errors.New("not connected or not logged in")
+
+	// ErrSendTimeout is returned by Send if the server did not respond to a message in time. The message may still
+	// have been delivered.
+	ErrSendTimeout = errors.New("sending message timed out")
+
+	// ErrTooManyInFlightSends is returned by Send if the limit set with SetMaxInFlightSends is reached and failFast
+	// is set.
+	ErrTooManyInFlightSends = errors.New("too many sends in flight")
+
+	// ErrMediaSizeMismatch is returned by Download if the downloaded media is larger than the file length of the
+	// message, or if the decrypted media does not have the announced length.
+	ErrMediaSizeMismatch = errors.New("media size does not match file length")
+
+	// ErrMediaHashMismatch is returned by Download, DownloadToWriter and DownloadEncrypted if the mac or hash of the
+	// downloaded media does not match, i.e. the media is corrupt or was truncated. Network errors are returned as is.
+	ErrMediaHashMismatch = errors.New("media hash does not match")
+
+	// ErrMediaTooLarge is returned by the download functions if the media exceeds DefaultMaxMediaSize, or
+	// Conn.MaxMediaSize for DownloadMedia.
+	ErrMediaTooLarge = errors.New("media exceeds the maximum media size")
+
+	// ErrMediaExpired is returned by Download and MediaAvailable if the media was removed from the WhatsApp servers.
+	ErrMediaExpired = errors.New("media expired")
+
+	// ErrReadReceiptsDisabled is returned by Read if the account has read receipts disabled.
+	ErrReadReceiptsDisabled = errors.New("read receipts are disabled")
+)
@@ -0,0 +1,90 @@
+package whatsapp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+ExportFormat is the format of transcripts written by ExportChat.
+*/
+type ExportFormat int
+
+const (
+	// ExportWhatsAppText is the plain text format of the _chat.txt files written by the chat export of WhatsApp.
+	ExportWhatsAppText ExportFormat = iota
+)
+
+/*
+ExportChat renders messages as a transcript, e.g. for archiving. The messages are written in the given order, one per
+line of the form "[02.01.06, 15:04:05] Sender: text" in local time. The sender is the push name of the sender, or its
+phone number if the push name is unknown, and "You" for own messages. Media is not embedded, media messages are written
+as placeholder with their type, e.g. "<image omitted>", followed by the caption. Deleted messages are written as "This
+message was deleted". messages may contain all message types of the package, other values cause an error.
+*/
+func ExportChat(messages []interface{}, format ExportFormat) ([]byte, error) {
+	if format != ExportWhatsAppText {
+		return nil, fmt.Errorf("unknown export format %d", format)
+	}
+
+	var b bytes.Buffer
+	for _, msg := range messages {
+		var text string
+		switch m := msg.(type) {
+		case TextMessage:
+			text = m.Text
+		case ImageMessage:
+			text = strings.TrimSpace("<image omitted> " + m.Caption)
+		case VideoMessage:
+			text = strings.TrimSpace("<video omitted> " + m.Caption)
+		case AudioMessage:
+			text = "<audio omitted>"
+		case DocumentMessage:
+			text = strings.TrimSpace("<document omitted> " + m.Title)
+		case StickerMessage:
+			text = "<sticker omitted>"
+		case ContactMessage:
+			text = strings.TrimSpace("<contact omitted> " + m.DisplayName)
+		case ContactsArrayMessage:
+			text = strings.TrimSpace("<contacts omitted> " + m.DisplayName)
+		case LocationMessage:
+			text = fmt.Sprintf("location: https://maps.google.com/?q=%v,%v", m.DegreesLatitude, m.DegreesLongitude)
+		case LiveLocationMessage:
+			text = "<live location omitted>"
+		case TemplateMessage:
+			text = "<template " + m.ElementName + ">"
+		case RevokedMessage:
+			text = "This message was deleted"
+		case PlaceholderMessage:
+			text = "<message not available>"
+		default:
+			return nil, fmt.Errorf("cannot match type %T, use message types declared in the package", msg)
+		}
+
+		info := msg.(MessageInfoGetter).GetInfo()
+		ts := time.Unix(int64(info.Timestamp), 0).Format("02.01.06, 15:04:05")
+		fmt.Fprintf(&b, "[%s] %s: %s\n", ts, exportSender(info), text)
+	}
+
+	return b.Bytes(), nil
+}
+
+func exportSender(info MessageInfo) string {
+	if info.FromMe {
+		return "You"
+	}
+	if info.PushName != "" {
+		return info.PushName
+	}
+
+	jid := info.SenderJid
+	if jid == "" {
+		jid = info.RemoteJid
+	}
+	if i := strings.Index(jid, "@"); i >= 0 && strings.HasSuffix(normalizeJid(jid), "@"+userServer) {
+		return "+" + jid[:i]
+	}
+	return jid
+}
@@ -0,0 +1,33 @@
+package whatsapp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExportChat(t *testing.T) {
+	ts := uint64(time.Date(2020, 1, 2, 15, 4, 5, 0, time.Local).Unix())
+	chat := "491234567890@s.whatsapp.net"
+
+	data, err := ExportChat([]interface{}{
+		TextMessage{Info: MessageInfo{RemoteJid: chat, Timestamp: ts, PushName: "Alice"}, Text: "hi"},
+		TextMessage{Info: MessageInfo{RemoteJid: chat, Timestamp: ts, FromMe: true}, Text: "hello"},
+		ImageMessage{Info: MessageInfo{RemoteJid: chat, Timestamp: ts}, Caption: "look"},
+		AudioMessage{Info: MessageInfo{RemoteJid: chat, Timestamp: ts}},
+	}, ExportWhatsAppText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[02.01.20, 15:04:05] Alice: hi\n" +
+		"[02.01.20, 15:04:05] You: hello\n" +
+		"[02.01.20, 15:04:05] +491234567890: <image omitted> look\n" +
+		"[02.01.20, 15:04:05] +491234567890: <audio omitted>\n"
+	if string(data) != expected {
+		t.Errorf("unexpected transcript:\n%s", data)
+	}
+
+	if _, err := ExportChat([]interface{}{"text"}, ExportWhatsAppText); err == nil {
+		t.Error("no error for unknown message type")
+	}
+}
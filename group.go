@@ -0,0 +1,98 @@
+package whatsapp
+
+import "github.com/Rhymen/go-whatsapp/binary/proto"
+
+/*
+GroupEventType is the kind of change of a GroupEvent. Every type has its own handler interface, e.g. GroupJoinHandler,
+which receives the values relevant for the change; GroupEventHandler receives the events of all types.
+*/
+type GroupEventType string
+
+const (
+	// GroupCreate is the creation of the group, Subject is the initial subject.
+	GroupCreate GroupEventType = "create"
+	// GroupJoin reports Participants that were added by Author or joined with an invite link.
+	GroupJoin GroupEventType = "join"
+	// GroupLeave reports Participants that left the group.
+	GroupLeave GroupEventType = "leave"
+	// GroupRemove reports Participants that were removed by Author.
+	GroupRemove GroupEventType = "remove"
+	// GroupPromote reports Participants that were made admins by Author.
+	GroupPromote GroupEventType = "promote"
+	// GroupDemote reports Participants whose admin rights were revoked by Author.
+	GroupDemote GroupEventType = "demote"
+	// GroupSubjectChange is a change of the subject to Subject.
+	GroupSubjectChange GroupEventType = "subject"
+	// GroupDescriptionChange is a change of the description to Description.
+	GroupDescriptionChange GroupEventType = "description"
+	// GroupIconChange is a change of the group icon, the new icon can be fetched with GetProfilePicThumb.
+	GroupIconChange GroupEventType = "icon"
+)
+
+/*
+GroupEvent represents a change of a group, e.g. a participant that joined or a new subject. Group changes are reported
+by stub messages in the group chat, GroupEvents are the parsed form of these stubs. Author is the participant who made
+the change, it is empty if the change was not made by a participant (e.g. a join with an invite link). Participants are
+the participants added, removed, promoted or demoted by the change. Subject is set for GroupCreate and
+GroupSubjectChange events, Description for GroupDescriptionChange events.
+*/
+type GroupEvent struct {
+	Type         GroupEventType
+	GroupJid     string
+	Author       string
+	Participants []string
+	Subject      string
+	Description  string
+	Timestamp    uint64
+}
+
+var groupStubTypes = map[proto.WebMessageInfo_STUBTYPE]GroupEventType{
+	proto.WebMessageInfo_GROUP_CREATE:              GroupCreate,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_ADD:     GroupJoin,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_INVITE:  GroupJoin,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_LEAVE:   GroupLeave,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_REMOVE:  GroupRemove,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_PROMOTE: GroupPromote,
+	proto.WebMessageInfo_GROUP_PARTICIPANT_DEMOTE:  GroupDemote,
+	proto.WebMessageInfo_GROUP_CHANGE_SUBJECT:      GroupSubjectChange,
+	proto.WebMessageInfo_GROUP_CHANGE_DESCRIPTION:  GroupDescriptionChange,
+	proto.WebMessageInfo_GROUP_CHANGE_ICON:         GroupIconChange,
+}
+
+// getGroupEvent returns the GroupEvent for the stub messages WhatsApp adds to a group chat for group changes.
+func getGroupEvent(msg *proto.WebMessageInfo) (GroupEvent, bool) {
+	t, ok := groupStubTypes[msg.GetMessageStubType()]
+	if !ok {
+		return GroupEvent{}, false
+	}
+
+	author := msg.GetParticipant()
+	if author == "" {
+		author = msg.GetKey().GetParticipant()
+	}
+
+	event := GroupEvent{
+		Type:      t,
+		GroupJid:  msg.GetKey().GetRemoteJid(),
+		Author:    normalizeJid(author),
+		Timestamp: msg.GetMessageTimestamp(),
+	}
+
+	params := msg.GetMessageStubParameters()
+	switch t {
+	case GroupCreate, GroupSubjectChange:
+		if len(params) > 0 {
+			event.Subject = params[0]
+		}
+	case GroupDescriptionChange:
+		if len(params) > 0 {
+			event.Description = params[0]
+		}
+	case GroupJoin, GroupLeave, GroupRemove, GroupPromote, GroupDemote:
+		for _, p := range params {
+			event.Participants = append(event.Participants, normalizeJid(p))
+		}
+	}
+
+	return event, true
+}
@@ -0,0 +1,115 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetGroupEvent(t *testing.T) {
+	group, id, author := "123456789-123456789@g.us", "ID", "491111111111@c.us"
+	event, ok := getGroupEvent(&proto.WebMessageInfo{
+		Key:                   &proto.MessageKey{RemoteJid: &group, Id: &id},
+		Participant:           &author,
+		MessageStubType:       proto.WebMessageInfo_GROUP_PARTICIPANT_ADD.Enum(),
+		MessageStubParameters: []string{"492222222222@c.us", "493333333333@s.whatsapp.net"},
+	})
+	if !ok {
+		t.Fatal("group event not found")
+	}
+
+	expected := GroupEvent{
+		Type:         GroupJoin,
+		GroupJid:     group,
+		Author:       "491111111111@s.whatsapp.net",
+		Participants: []string{"492222222222@s.whatsapp.net", "493333333333@s.whatsapp.net"},
+	}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	event, _ = getGroupEvent(&proto.WebMessageInfo{
+		Key:                   &proto.MessageKey{RemoteJid: &group, Id: &id},
+		MessageStubType:       proto.WebMessageInfo_GROUP_CHANGE_SUBJECT.Enum(),
+		MessageStubParameters: []string{"new subject"},
+	})
+	if event.Type != GroupSubjectChange || event.Subject != "new subject" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	event, _ = getGroupEvent(&proto.WebMessageInfo{
+		Key:                   &proto.MessageKey{RemoteJid: &group, Id: &id},
+		MessageStubType:       proto.WebMessageInfo_GROUP_CHANGE_DESCRIPTION.Enum(),
+		MessageStubParameters: []string{"new description"},
+	})
+	if event.Type != GroupDescriptionChange || event.Description != "new description" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	if _, ok := getGroupEvent(&proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &group, Id: &id}}); ok {
+		t.Error("group event for a normal message")
+	}
+}
+
+type groupHandler struct {
+	events chan []string
+}
+
+func (h *groupHandler) HandleError(err error) {}
+
+func (h *groupHandler) HandleGroupJoin(groupJid string, participants []string) {
+	h.events <- append([]string{"join", groupJid}, participants...)
+}
+
+func (h *groupHandler) HandleGroupSubjectChange(groupJid, newSubject string) {
+	h.events <- []string{"subject", groupJid, newSubject}
+}
+
+func (h *groupHandler) HandleGroupDescriptionChange(groupJid, newDescription string) {
+	h.events <- []string{"description", groupJid, newDescription}
+}
+
+func TestDispatchGroupEvents(t *testing.T) {
+	wac := &Conn{Store: newStore()}
+	h := &groupHandler{events: make(chan []string, 4)}
+	wac.AddHandler(h)
+
+	group, id := "123456789-123456789@g.us", "ID"
+	stub := func(t proto.WebMessageInfo_STUBTYPE, params ...string) *proto.WebMessageInfo {
+		return &proto.WebMessageInfo{
+			Key:                   &proto.MessageKey{RemoteJid: &group, Id: &id},
+			MessageStubType:       t.Enum(),
+			MessageStubParameters: params,
+		}
+	}
+	wac.dispatch(&binary.Node{Description: "action", Content: []interface{}{
+		stub(proto.WebMessageInfo_GROUP_PARTICIPANT_ADD, "492222222222@c.us"),
+		stub(proto.WebMessageInfo_GROUP_CHANGE_SUBJECT, "new subject"),
+		stub(proto.WebMessageInfo_GROUP_CHANGE_DESCRIPTION, "new description"),
+		// not implemented by the handler
+		stub(proto.WebMessageInfo_GROUP_PARTICIPANT_LEAVE, "493333333333@c.us"),
+	}})
+
+	expected := map[string][]string{
+		"join":        {"join", group, "492222222222@s.whatsapp.net"},
+		"subject":     {"subject", group, "new subject"},
+		"description": {"description", group, "new description"},
+	}
+	for range expected {
+		select {
+		case e := <-h.events:
+			if !reflect.DeepEqual(e, expected[e[0]]) {
+				t.Errorf("unexpected event %q", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("group event not dispatched")
+		}
+	}
+	select {
+	case e := <-h.events:
+		t.Errorf("unexpected event %q", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
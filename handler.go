@@ -58,6 +58,83 @@ type DocumentMessageHandler interface {
 	HandleDocumentMessage(message DocumentMessage)
 }
 
+/*
+The StickerMessageHandler interface needs to be implemented to receive sticker messages dispatched by the dispatcher.
+*/
+type StickerMessageHandler interface {
+	Handler
+	HandleStickerMessage(message StickerMessage)
+}
+
+/*
+The ContactMessageHandler interface needs to be implemented to receive contact messages dispatched by the dispatcher.
+*/
+type ContactMessageHandler interface {
+	Handler
+	HandleContactMessage(message ContactMessage)
+}
+
+/*
+The ContactsArrayMessageHandler interface needs to be implemented to receive messages with several contacts dispatched
+by the dispatcher.
+*/
+type ContactsArrayMessageHandler interface {
+	Handler
+	HandleContactsArrayMessage(message ContactsArrayMessage)
+}
+
+/*
+The LocationMessageHandler interface needs to be implemented to receive location messages dispatched by the dispatcher.
+*/
+type LocationMessageHandler interface {
+	Handler
+	HandleLocationMessage(message LocationMessage)
+}
+
+/*
+The LiveLocationMessageHandler interface needs to be implemented to receive live location messages and their updates
+dispatched by the dispatcher.
+*/
+type LiveLocationMessageHandler interface {
+	Handler
+	HandleLiveLocationMessage(message LiveLocationMessage)
+}
+
+/*
+The TemplateMessageHandler interface needs to be implemented to receive template messages dispatched by the dispatcher.
+*/
+type TemplateMessageHandler interface {
+	Handler
+	HandleTemplateMessage(message TemplateMessage)
+}
+
+/*
+The PlaceholderMessageHandler interface needs to be implemented to receive messages whose content has not been synced
+yet, see PlaceholderMessage.
+*/
+type PlaceholderMessageHandler interface {
+	Handler
+	HandlePlaceholderMessage(message PlaceholderMessage)
+}
+
+/*
+The RevokedMessageHandler interface needs to be implemented to receive notifications about messages that were deleted
+for everyone, see RevokedMessage.
+*/
+type RevokedMessageHandler interface {
+	Handler
+	HandleRevokedMessage(message RevokedMessage)
+}
+
+/*
+The ReceiptMessageHandler interface needs to be implemented to receive delivery and read receipts of sent messages, see
+ReceiptMessage.
+*/
+type ReceiptMessageHandler interface {
+	Handler
+	HandleReceiptMessage(message ReceiptMessage)
+}
+
 /*
 The JsonMessageHandler interface needs to be implemented to receive json messages dispatched by the dispatcher.
 These json messages contain status updates of every kind sent by WhatsAppWeb servers. WhatsAppWeb uses these messages
@@ -78,68 +155,381 @@ type RawMessageHandler interface {
 	HandleRawMessage(message *proto.WebMessageInfo)
 }
 
+/*
+The UnknownMessageHandler interface needs to be implemented to receive the raw protobuf structs of messages that the
+package can not parse into one of its message types, e.g. message types that are newer than the package. Unlike
+RawMessageHandler, which receives every message, it only receives messages that would otherwise be dropped.
+*/
+type UnknownMessageHandler interface {
+	Handler
+	HandleUnknownMessage(message *proto.WebMessageInfo)
+}
+
+// unknownMessage distinguishes messages for the UnknownMessageHandlers from the messages for the RawMessageHandlers.
+type unknownMessage struct {
+	*proto.WebMessageInfo
+}
+
+/*
+The CallHandler interface needs to be implemented to receive call events dispatched by the dispatcher.
+*/
+type CallHandler interface {
+	Handler
+	HandleCall(call CallEvent)
+}
+
+/*
+The GroupEventHandler interface needs to be implemented to receive all group changes dispatched by the dispatcher. The
+handlers of the single changes, e.g. GroupJoinHandler, receive the same changes in a simpler form.
+*/
+type GroupEventHandler interface {
+	Handler
+	HandleGroupEvent(event GroupEvent)
+}
+
+/*
+The GroupCreateHandler interface needs to be implemented to receive the creation of groups with their subject.
+*/
+type GroupCreateHandler interface {
+	Handler
+	HandleGroupCreate(groupJid, subject string)
+}
+
+/*
+The GroupJoinHandler interface needs to be implemented to receive participants that were added to a group or joined it.
+*/
+type GroupJoinHandler interface {
+	Handler
+	HandleGroupJoin(groupJid string, participants []string)
+}
+
+/*
+The GroupLeaveHandler interface needs to be implemented to receive participants that left a group.
+*/
+type GroupLeaveHandler interface {
+	Handler
+	HandleGroupLeave(groupJid string, participants []string)
+}
+
+/*
+The GroupRemoveHandler interface needs to be implemented to receive participants that were removed from a group by an
+admin.
+*/
+type GroupRemoveHandler interface {
+	Handler
+	HandleGroupRemove(groupJid string, participants []string)
+}
+
+/*
+The GroupPromoteHandler interface needs to be implemented to receive participants that were made admins of a group.
+*/
+type GroupPromoteHandler interface {
+	Handler
+	HandleGroupPromote(groupJid string, participants []string)
+}
+
+/*
+The GroupDemoteHandler interface needs to be implemented to receive admins of a group that were demoted.
+*/
+type GroupDemoteHandler interface {
+	Handler
+	HandleGroupDemote(groupJid string, participants []string)
+}
+
+/*
+The GroupSubjectChangeHandler interface needs to be implemented to receive new subjects of groups.
+*/
+type GroupSubjectChangeHandler interface {
+	Handler
+	HandleGroupSubjectChange(groupJid, newSubject string)
+}
+
+/*
+The GroupDescriptionChangeHandler interface needs to be implemented to receive new descriptions of groups.
+*/
+type GroupDescriptionChangeHandler interface {
+	Handler
+	HandleGroupDescriptionChange(groupJid, newDescription string)
+}
+
+/*
+The GroupIconChangeHandler interface needs to be implemented to receive changes of group icons.
+*/
+type GroupIconChangeHandler interface {
+	Handler
+	HandleGroupIconChange(groupJid string)
+}
+
 /*
 AddHandler adds an handler to the list of handler that receive dispatched messages.
 The provided handler must at least implement the Handler interface. Additionally implemented
 handlers(TextMessageHandler, ImageMessageHandler) are optional. At runtime it is checked if they are implemented
-and they are called if so and needed.
+and they are called if so and needed. Handlers can be added and removed at any time, also while messages are
+dispatched.
 */
 func (wac *Conn) AddHandler(handler Handler) {
-	wac.handler = append(wac.handler, handler)
+	wac.handlerMutex.Lock()
+	defer wac.handlerMutex.Unlock()
+
+	// copy on write, dispatching iterates over the old list without locking
+	handlers := make([]Handler, len(wac.handler), len(wac.handler)+1)
+	copy(handlers, wac.handler)
+	wac.handler = append(handlers, handler)
+}
+
+/*
+RemoveHandler removes a handler that was added with AddHandler and reports whether it was found. Handlers are compared
+with ==, so the handler has to be of a comparable type, e.g. a pointer. Messages that are already being dispatched may
+still reach the removed handler.
+*/
+func (wac *Conn) RemoveHandler(handler Handler) bool {
+	wac.handlerMutex.Lock()
+	defer wac.handlerMutex.Unlock()
+
+	for i, h := range wac.handler {
+		if h == handler {
+			handlers := make([]Handler, 0, len(wac.handler)-1)
+			handlers = append(handlers, wac.handler[:i]...)
+			wac.handler = append(handlers, wac.handler[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (wac *Conn) getHandlers() []Handler {
+	wac.handlerMutex.RLock()
+	defer wac.handlerMutex.RUnlock()
+	return wac.handler
+}
+
+/*
+SetHandledTypes restricts the messages that are parsed and dispatched to the handlers to the given kinds. Messages of
+other kinds are dropped before parsing, which saves the work of building the message structs in deployments that are
+only interested in a few kinds of messages. Calling it without arguments restores the default of handling all kinds.
+Raw messages are dispatched to RawMessageHandlers regardless of this setting.
+*/
+func (wac *Conn) SetHandledTypes(kinds ...MessageKind) {
+	var handled map[MessageKind]bool
+	if len(kinds) > 0 {
+		handled = make(map[MessageKind]bool, len(kinds))
+		for _, k := range kinds {
+			handled[k] = true
+		}
+	}
+
+	wac.handlerMutex.Lock()
+	wac.handledKinds = handled
+	wac.handlerMutex.Unlock()
+}
+
+func (wac *Conn) isHandledKind(kind MessageKind) bool {
+	wac.handlerMutex.RLock()
+	defer wac.handlerMutex.RUnlock()
+	return wac.handledKinds == nil || wac.handledKinds[kind]
+}
+
+/*
+ReceiveMiddleware is called for every parsed incoming message before it is dispatched to the handlers. It returns the
+message that should be dispatched instead and whether the message should be dispatched at all.
+*/
+type ReceiveMiddleware func(msg interface{}) (interface{}, bool)
+
+/*
+AddReceiveMiddleware adds a middleware that is run on every parsed incoming message (TextMessage, ImageMessage, ...).
+Middlewares run in the order they were added, each one receives the message returned by the previous one. If a
+middleware returns false, the message is dropped and neither later middlewares nor handlers see it. Raw messages are
+dispatched to RawMessageHandlers before the middlewares run.
+*/
+func (wac *Conn) AddReceiveMiddleware(middleware ReceiveMiddleware) {
+	wac.middlewareMutex.Lock()
+	wac.receiveMiddleware = append(wac.receiveMiddleware, middleware)
+	wac.middlewareMutex.Unlock()
+}
+
+func (wac *Conn) applyReceiveMiddleware(msg interface{}) (interface{}, bool) {
+	wac.middlewareMutex.RLock()
+	middleware := wac.receiveMiddleware
+	wac.middlewareMutex.RUnlock()
+
+	for _, m := range middleware {
+		var ok bool
+		if msg, ok = m(msg); !ok {
+			return nil, false
+		}
+	}
+	return msg, true
 }
 
 func (wac *Conn) handle(message interface{}) {
+	handlers := wac.getHandlers()
+
 	switch m := message.(type) {
 	case error:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			go h.HandleError(m)
 		}
 	case string:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(JsonMessageHandler); ok {
 				go x.HandleJsonMessage(m)
 			}
 		}
 	case TextMessage:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(TextMessageHandler); ok {
 				go x.HandleTextMessage(m)
 			}
 		}
 	case ImageMessage:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(ImageMessageHandler); ok {
 				go x.HandleImageMessage(m)
 			}
 		}
 	case VideoMessage:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(VideoMessageHandler); ok {
 				go x.HandleVideoMessage(m)
 			}
 		}
 	case AudioMessage:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(AudioMessageHandler); ok {
 				go x.HandleAudioMessage(m)
 			}
 		}
 	case DocumentMessage:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(DocumentMessageHandler); ok {
 				go x.HandleDocumentMessage(m)
 			}
 		}
+	case StickerMessage:
+		for _, h := range handlers {
+			if x, ok := h.(StickerMessageHandler); ok {
+				go x.HandleStickerMessage(m)
+			}
+		}
+	case ContactMessage:
+		for _, h := range handlers {
+			if x, ok := h.(ContactMessageHandler); ok {
+				go x.HandleContactMessage(m)
+			}
+		}
+	case ContactsArrayMessage:
+		for _, h := range handlers {
+			if x, ok := h.(ContactsArrayMessageHandler); ok {
+				go x.HandleContactsArrayMessage(m)
+			}
+		}
+	case LocationMessage:
+		for _, h := range handlers {
+			if x, ok := h.(LocationMessageHandler); ok {
+				go x.HandleLocationMessage(m)
+			}
+		}
+	case LiveLocationMessage:
+		for _, h := range handlers {
+			if x, ok := h.(LiveLocationMessageHandler); ok {
+				go x.HandleLiveLocationMessage(m)
+			}
+		}
+	case TemplateMessage:
+		for _, h := range handlers {
+			if x, ok := h.(TemplateMessageHandler); ok {
+				go x.HandleTemplateMessage(m)
+			}
+		}
+	case PlaceholderMessage:
+		for _, h := range handlers {
+			if x, ok := h.(PlaceholderMessageHandler); ok {
+				go x.HandlePlaceholderMessage(m)
+			}
+		}
+	case RevokedMessage:
+		for _, h := range handlers {
+			if x, ok := h.(RevokedMessageHandler); ok {
+				go x.HandleRevokedMessage(m)
+			}
+		}
+	case ReceiptMessage:
+		for _, h := range handlers {
+			if x, ok := h.(ReceiptMessageHandler); ok {
+				go x.HandleReceiptMessage(m)
+			}
+		}
 	case *proto.WebMessageInfo:
-		for _, h := range wac.handler {
+		for _, h := range handlers {
 			if x, ok := h.(RawMessageHandler); ok {
 				go x.HandleRawMessage(m)
 			}
 		}
+	case unknownMessage:
+		for _, h := range handlers {
+			if x, ok := h.(UnknownMessageHandler); ok {
+				go x.HandleUnknownMessage(m.WebMessageInfo)
+			}
+		}
+	case CallEvent:
+		for _, h := range handlers {
+			if x, ok := h.(CallHandler); ok {
+				go x.HandleCall(m)
+			}
+		}
+	case GroupEvent:
+		for _, h := range handlers {
+			if x, ok := h.(GroupEventHandler); ok {
+				go x.HandleGroupEvent(m)
+			}
+			handleGroupEvent(h, m)
+		}
 	}
 
 }
 
+// handleGroupEvent passes event to h if h implements the handler of the type of event.
+func handleGroupEvent(h Handler, event GroupEvent) {
+	switch event.Type {
+	case GroupCreate:
+		if x, ok := h.(GroupCreateHandler); ok {
+			go x.HandleGroupCreate(event.GroupJid, event.Subject)
+		}
+	case GroupJoin:
+		if x, ok := h.(GroupJoinHandler); ok {
+			go x.HandleGroupJoin(event.GroupJid, event.Participants)
+		}
+	case GroupLeave:
+		if x, ok := h.(GroupLeaveHandler); ok {
+			go x.HandleGroupLeave(event.GroupJid, event.Participants)
+		}
+	case GroupRemove:
+		if x, ok := h.(GroupRemoveHandler); ok {
+			go x.HandleGroupRemove(event.GroupJid, event.Participants)
+		}
+	case GroupPromote:
+		if x, ok := h.(GroupPromoteHandler); ok {
+			go x.HandleGroupPromote(event.GroupJid, event.Participants)
+		}
+	case GroupDemote:
+		if x, ok := h.(GroupDemoteHandler); ok {
+			go x.HandleGroupDemote(event.GroupJid, event.Participants)
+		}
+	case GroupSubjectChange:
+		if x, ok := h.(GroupSubjectChangeHandler); ok {
+			go x.HandleGroupSubjectChange(event.GroupJid, event.Subject)
+		}
+	case GroupDescriptionChange:
+		if x, ok := h.(GroupDescriptionChangeHandler); ok {
+			go x.HandleGroupDescriptionChange(event.GroupJid, event.Description)
+		}
+	case GroupIconChange:
+		if x, ok := h.(GroupIconChangeHandler); ok {
+			go x.HandleGroupIconChange(event.GroupJid)
+		}
+	}
+}
+
 func (wac *Conn) dispatch(msg interface{}) {
 	if msg == nil {
 		return
@@ -151,8 +541,25 @@ func (wac *Conn) dispatch(msg interface{}) {
 			if con, ok := message.Content.([]interface{}); ok {
 				for a := range con {
 					if v, ok := con[a].(*proto.WebMessageInfo); ok {
+						wac.Store.addMessage(v)
 						wac.handle(v)
-						wac.handle(parseProtoMessage(v))
+						call, isCall := getMissedCall(v)
+						if isCall {
+							wac.handle(call)
+						}
+						event, isEvent := getGroupEvent(v)
+						if isEvent {
+							wac.handle(event)
+						}
+						if kind := getMessageKind(v); kind == KindUnknown {
+							if !isCall && !isEvent {
+								wac.handle(unknownMessage{v})
+							}
+						} else if wac.isHandledKind(kind) {
+							if m, ok := wac.applyReceiveMiddleware(parseProtoMessage(v)); ok {
+								wac.handle(m)
+							}
+						}
 					}
 				}
 			}
@@ -163,6 +570,17 @@ func (wac *Conn) dispatch(msg interface{}) {
 		wac.handle(message)
 	case string:
 		wac.handle(message)
+		if call, ok := parseCallJson(message); ok {
+			wac.handle(call)
+		}
+		if blocklist, ok := parseBlocklistJson(message); ok {
+			wac.Store.setBlocklist(blocklist)
+		}
+		if receipts, ok := parseReceiptJson(message); ok {
+			for _, r := range receipts {
+				wac.handle(r)
+			}
+		}
 	default:
 		fmt.Fprintf(os.Stderr, "unknown type in dipatcher chan: %T", msg)
 	}
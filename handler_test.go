@@ -0,0 +1,283 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingHandler struct {
+	texts   int32
+	handled *sync.WaitGroup
+}
+
+func (h *countingHandler) HandleError(err error) {}
+
+func (h *countingHandler) HandleTextMessage(message TextMessage) {
+	atomic.AddInt32(&h.texts, 1)
+	if h.handled != nil {
+		h.handled.Done()
+	}
+}
+
+func TestAddRemoveHandlerWhileDispatching(t *testing.T) {
+	wac := &Conn{}
+	var handled sync.WaitGroup
+	handled.Add(1000)
+	permanent := &countingHandler{handled: &handled}
+	wac.AddHandler(permanent)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			h := &countingHandler{}
+			wac.AddHandler(h)
+			if !wac.RemoveHandler(h) {
+				t.Error("added handler not found")
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			wac.handle(TextMessage{})
+		}
+	}()
+	wg.Wait()
+
+	// handlers are called in their own goroutines
+	done := make(chan struct{})
+	go func() {
+		handled.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("permanent handler got %d of 1000 messages", atomic.LoadInt32(&permanent.texts))
+	}
+	if n := atomic.LoadInt32(&permanent.texts); n != 1000 {
+		t.Errorf("permanent handler got %d of 1000 messages", n)
+	}
+
+	if wac.RemoveHandler(&countingHandler{}) {
+		t.Error("unknown handler removed")
+	}
+	if len(wac.getHandlers()) != 1 || wac.getHandlers()[0] != permanent {
+		t.Errorf("unexpected handlers %v", wac.getHandlers())
+	}
+}
+
+type unknownHandler struct {
+	unknown chan *proto.WebMessageInfo
+}
+
+func (h *unknownHandler) HandleError(err error) {}
+
+func (h *unknownHandler) HandleUnknownMessage(message *proto.WebMessageInfo) {
+	h.unknown <- message
+}
+
+func TestDispatchUnknownMessage(t *testing.T) {
+	wac := &Conn{Store: newStore()}
+	h := &unknownHandler{unknown: make(chan *proto.WebMessageInfo, 2)}
+	wac.AddHandler(h)
+
+	remoteJid, text := "491234567890@s.whatsapp.net", "hi"
+	payment := &proto.WebMessageInfo{
+		Key:     &proto.MessageKey{RemoteJid: &remoteJid},
+		Message: &proto.Message{RequestPaymentMessage: &proto.RequestPaymentMessage{}},
+	}
+	wac.dispatch(&binary.Node{Description: "action", Content: []interface{}{
+		&proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &remoteJid}, Message: &proto.Message{Conversation: &text}},
+		payment,
+	}})
+
+	select {
+	case m := <-h.unknown:
+		if m != payment {
+			t.Errorf("unexpected unknown message %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unknown message not dispatched")
+	}
+	select {
+	case m := <-h.unknown:
+		t.Errorf("known message dispatched as unknown: %v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type kindHandler struct {
+	received chan string
+}
+
+func (h *kindHandler) HandleError(err error) {}
+
+func (h *kindHandler) HandleTextMessage(message TextMessage) {
+	h.received <- "text"
+}
+
+func (h *kindHandler) HandleImageMessage(message ImageMessage) {
+	h.received <- "image"
+}
+
+func (h *kindHandler) HandleLocationMessage(message LocationMessage) {
+	h.received <- "location"
+}
+
+func (h *kindHandler) HandleRawMessage(message *proto.WebMessageInfo) {
+	h.received <- "raw"
+}
+
+func TestSetHandledTypes(t *testing.T) {
+	wac := &Conn{Store: newStore()}
+	h := &kindHandler{received: make(chan string, 10)}
+	wac.AddHandler(h)
+
+	// the receive middleware sees every parsed message
+	var parsed []string
+	var mutex sync.Mutex
+	wac.AddReceiveMiddleware(func(msg interface{}) (interface{}, bool) {
+		mutex.Lock()
+		parsed = append(parsed, reflect.TypeOf(msg).Name())
+		mutex.Unlock()
+		return msg, true
+	})
+
+	jid, text := "491234567890@s.whatsapp.net", "hi"
+	batch := func() *binary.Node {
+		messages := []*proto.Message{
+			{Conversation: &text},
+			{ImageMessage: &proto.ImageMessage{}},
+			{LocationMessage: &proto.LocationMessage{}},
+		}
+		content := make([]interface{}, len(messages))
+		for i, m := range messages {
+			id := strconv.Itoa(i)
+			content[i] = &proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &jid, Id: &id}, Message: m}
+		}
+		return &binary.Node{Description: "action", Content: content}
+	}
+	received := func(n int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-h.received:
+				counts[r]++
+			case <-time.After(time.Second):
+				t.Fatalf("got %d of %d messages", i, n)
+			}
+		}
+		select {
+		case r := <-h.received:
+			t.Errorf("unexpected %s message", r)
+		case <-time.After(10 * time.Millisecond):
+		}
+		return counts
+	}
+
+	wac.SetHandledTypes(KindText)
+	wac.dispatch(batch())
+	if counts := received(4); !reflect.DeepEqual(counts, map[string]int{"raw": 3, "text": 1}) {
+		t.Errorf("unexpected messages %v", counts)
+	}
+	mutex.Lock()
+	if !reflect.DeepEqual(parsed, []string{"TextMessage"}) {
+		t.Errorf("filtered messages parsed: %v", parsed)
+	}
+	parsed = nil
+	mutex.Unlock()
+
+	wac.SetHandledTypes()
+	wac.dispatch(batch())
+	if counts := received(6); !reflect.DeepEqual(counts, map[string]int{"raw": 3, "text": 1, "image": 1, "location": 1}) {
+		t.Errorf("unexpected messages %v", counts)
+	}
+}
+
+func TestReceiveMiddleware(t *testing.T) {
+	appendText := func(calls *[]string, name string) ReceiveMiddleware {
+		return func(msg interface{}) (interface{}, bool) {
+			*calls = append(*calls, name)
+			m := msg.(TextMessage)
+			m.Text += name
+			return m, true
+		}
+	}
+	drop := func(calls *[]string) ReceiveMiddleware {
+		return func(msg interface{}) (interface{}, bool) {
+			*calls = append(*calls, "drop")
+			return nil, false
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		middleware func(calls *[]string) []ReceiveMiddleware
+		text       string
+		dispatched bool
+		calls      []string
+	}{
+		{"none", func(calls *[]string) []ReceiveMiddleware { return nil }, "hi", true, nil},
+		{"chain", func(calls *[]string) []ReceiveMiddleware {
+			return []ReceiveMiddleware{appendText(calls, "1"), appendText(calls, "2")}
+		}, "hi12", true, []string{"1", "2"}},
+		{"drop", func(calls *[]string) []ReceiveMiddleware {
+			return []ReceiveMiddleware{appendText(calls, "1"), drop(calls), appendText(calls, "2")}
+		}, "", false, []string{"1", "drop"}},
+	} {
+		var calls []string
+		wac := &Conn{}
+		for _, m := range tc.middleware(&calls) {
+			wac.AddReceiveMiddleware(m)
+		}
+
+		msg, ok := wac.applyReceiveMiddleware(TextMessage{Text: "hi"})
+		if ok != tc.dispatched {
+			t.Errorf("%s: dispatched is %v", tc.name, ok)
+		}
+		if text, _ := msg.(TextMessage); ok && text.Text != tc.text {
+			t.Errorf("%s: unexpected text %q", tc.name, text.Text)
+		}
+		if !reflect.DeepEqual(calls, tc.calls) {
+			t.Errorf("%s: unexpected calls %v", tc.name, calls)
+		}
+	}
+
+	// dropped messages only reach the raw message handlers
+	wac := &Conn{Store: newStore()}
+	h := &kindHandler{received: make(chan string, 4)}
+	wac.AddHandler(h)
+	wac.AddReceiveMiddleware(func(msg interface{}) (interface{}, bool) {
+		return msg, msg.(TextMessage).Text != "spam"
+	})
+
+	jid, id := "491234567890@s.whatsapp.net", "ID"
+	for _, text := range []string{"spam", "hi"} {
+		text := text
+		wac.dispatch(&binary.Node{Description: "action", Content: []interface{}{
+			&proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &jid, Id: &id}, Message: &proto.Message{Conversation: &text}},
+		}})
+	}
+	counts := map[string]int{}
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-h.received:
+			counts[r]++
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of 3 messages", i)
+		}
+	}
+	if !reflect.DeepEqual(counts, map[string]int{"raw": 2, "text": 1}) {
+		t.Errorf("unexpected messages %v", counts)
+	}
+}
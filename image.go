@@ -0,0 +1,462 @@
+package whatsapp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// maxImagePixels is the largest number of pixels decodeImage decodes. The decoded image takes four bytes per pixel, so
+// larger images are refused instead of allocating hundreds of megabytes for an image that is scaled down anyway.
+const maxImagePixels = 50 * 1000 * 1000
+
+// decodeImage decodes a jpeg or png image. The orientation stored in the exif data of jpeg images is applied, so the
+// returned image is upright. Images with more than maxImagePixels pixels are refused.
+func decodeImage(data []byte) (*image.RGBA, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels exceeds the limit of %d pixels", cfg.Width, cfg.Height, maxImagePixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	return orientImage(img, jpegOrientation(data)), nil
+}
+
+// scaleImage scales img down to fit into a maxDim x maxDim square while keeping its aspect ratio. Every target pixel
+// is the average of the source pixels it covers. Images that already fit are returned unchanged.
+func scaleImage(img *image.RGBA, maxDim int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	if maxDim <= 0 || (sw <= maxDim && sh <= maxDim) {
+		return img
+	}
+
+	dw, dh := maxDim, maxDim
+	if sw > sh {
+		dh = (sh*maxDim + sw/2) / sw
+	} else {
+		dw = (sw*maxDim + sh/2) / sh
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := img.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(img.Pix[i])
+					g += int(img.Pix[i+1])
+					b += int(img.Pix[i+2])
+					a += int(img.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+func encodeJpeg(img image.Image, quality int) ([]byte, error) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// orientImage transforms img according to the exif orientation o (1-8), so that it is displayed upright.
+func orientImage(img *image.RGBA, o int) *image.RGBA {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation returns the exif orientation of a jpeg image, or 1 (upright) if data is no jpeg or has no
+// orientation.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// image data starts, exif data has to be in front of it
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		if marker == 0xE1 {
+			if o := exifOrientation(data[i+4 : i+2+size]); o != 0 {
+				return o
+			}
+		}
+		i += 2 + size
+	}
+
+	return 1
+}
+
+func exifOrientation(app1 []byte) int {
+	if len(app1) < 14 || string(app1[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := app1[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < entries; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+
+	return 0
+}
+
+// resizeImageMessage downscales the content of msg to maxDim, see Conn.MaxImageDimension. Png images stay png, so
+// their transparency is kept, jpeg images are encoded as jpeg again.
+func resizeImageMessage(msg *ImageMessage, maxDim int) error {
+	data, err := ioutil.ReadAll(msg.Content)
+	if err != nil {
+		return err
+	}
+	msg.Content = bytes.NewReader(data)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (cfg.Width <= maxDim && cfg.Height <= maxDim) {
+		// leave content the image package can not decode to the server
+		return nil
+	}
+
+	img, err := decodeImage(data)
+	if err != nil {
+		return fmt.Errorf("error decoding image: %v", err)
+	}
+	img = scaleImage(img, maxDim)
+
+	var resized []byte
+	if format == "png" {
+		var b bytes.Buffer
+		err = png.Encode(&b, img)
+		resized = b.Bytes()
+	} else {
+		resized, err = encodeJpeg(img, 90)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding image: %v", err)
+	}
+
+	msg.Content = bytes.NewReader(resized)
+	msg.Type = "image/" + format
+	return nil
+}
+
+// thumbnailSize is the size of the thumbnails generated for images sent without Thumbnail.
+const thumbnailSize = 100
+
+/*
+GenerateThumbnail decodes a jpeg or png image, scales it down to fit into a maxDim x maxDim square and returns it as jpeg,
+suitable as Thumbnail of media messages. Send generates thumbnails for images without Thumbnail itself. Videos are not
+decoded by the package, their thumbnail has to be rendered from a frame of the video by the caller, e.g. with ffmpeg,
+and can then be scaled with GenerateThumbnail.
+*/
+func GenerateThumbnail(r io.Reader, maxDim int) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+	return encodeJpeg(scaleImage(img, maxDim), 75)
+}
+
+// generateImageThumbnail sets the thumbnail of images that are sent without one. Content the image package can not
+// decode is sent without thumbnail. Seekable content is rewound instead of being kept in memory.
+func generateImageThumbnail(msg *ImageMessage) error {
+	if msg.Thumbnail != nil || msg.Content == nil {
+		return nil
+	}
+
+	data, err := readImageContent(msg)
+	if err != nil {
+		return err
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil
+	}
+	msg.Thumbnail, err = GenerateThumbnail(bytes.NewReader(data), thumbnailSize)
+	return err
+}
+
+// readImageContent reads the content of msg. Seekable content is rewound afterwards, so it stays seekable for
+// streaming uploads, other content is replaced with the read data.
+func readImageContent(msg *ImageMessage) ([]byte, error) {
+	var start int64
+	rs, seekable := msg.Content.(io.ReadSeeker)
+	if seekable {
+		var err error
+		if start, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	data, err := ioutil.ReadAll(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+	if seekable {
+		if _, err = rs.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else {
+		msg.Content = bytes.NewReader(data)
+	}
+	return data, nil
+}
+
+// blurImageThumbnail replaces the thumbnail of msg with a blurred one, see Conn.BlurThumbnails. Images without
+// thumbnail get a blurred thumbnail of their content. Like generateImageThumbnail, images that can not be decoded are
+// left as they are.
+func blurImageThumbnail(msg *ImageMessage) error {
+	data := msg.Thumbnail
+	if data == nil {
+		if msg.Content == nil {
+			return nil
+		}
+		content, err := readImageContent(msg)
+		if err != nil {
+			return err
+		}
+		data = content
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil
+	}
+
+	thumbnail, err := blurThumbnail(data)
+	if err != nil {
+		return err
+	}
+	msg.Thumbnail = thumbnail
+	return nil
+}
+
+// blurredThumbnailSize is the size of blurred thumbnails, blurThumbnailDetail the size the image is reduced to before.
+const (
+	blurredThumbnailSize = 48
+	blurThumbnailDetail  = 8
+)
+
+// blurThumbnail returns a blurred jpeg thumbnail of the jpeg or png image data. The image is scaled down until only
+// coarse colors are left and interpolated back up, so the thumbnail shows no details.
+func blurThumbnail(data []byte) ([]byte, error) {
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	small := scaleImage(img, blurThumbnailDetail)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+	dw, dh := blurredThumbnailSize, blurredThumbnailSize
+	if w > h {
+		dh = (h*blurredThumbnailSize + w/2) / w
+	} else {
+		dw = (w*blurredThumbnailSize + h/2) / h
+	}
+
+	return encodeJpeg(interpolateImage(small, dw, dh), 50)
+}
+
+// interpolateImage scales img up to dw x dh with bilinear interpolation.
+func interpolateImage(img *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		fy := (float64(y)+0.5)*float64(sh)/float64(dh) - 0.5
+		y0 := clamp(int(math.Floor(fy)), 0, sh-1)
+		y1 := clamp(y0+1, 0, sh-1)
+		wy := math.Max(0, math.Min(1, fy-float64(y0)))
+
+		for x := 0; x < dw; x++ {
+			fx := (float64(x)+0.5)*float64(sw)/float64(dw) - 0.5
+			x0 := clamp(int(math.Floor(fx)), 0, sw-1)
+			x1 := clamp(x0+1, 0, sw-1)
+			wx := math.Max(0, math.Min(1, fx-float64(x0)))
+
+			i00, i01 := img.PixOffset(x0, y0), img.PixOffset(x1, y0)
+			i10, i11 := img.PixOffset(x0, y1), img.PixOffset(x1, y1)
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				top := float64(img.Pix[i00+c])*(1-wx) + float64(img.Pix[i01+c])*wx
+				bottom := float64(img.Pix[i10+c])*(1-wx) + float64(img.Pix[i11+c])*wx
+				dst.Pix[d+c] = uint8(top*(1-wy) + bottom*wy + 0.5)
+			}
+		}
+	}
+
+	return dst
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// stickerSize is the width and height of stickers.
+const stickerSize = 512
+
+// validateSticker reads the content of msg and checks that it is a 512x512 WebP image. It sets the mimetype and size
+// of the sticker.
+func validateSticker(msg *StickerMessage) error {
+	if msg.Content == nil {
+		return fmt.Errorf("sticker has no content")
+	}
+	data, err := ioutil.ReadAll(msg.Content)
+	if err != nil {
+		return err
+	}
+	msg.Content = bytes.NewReader(data)
+
+	w, h, ok := webpSize(data)
+	if !ok {
+		return fmt.Errorf("sticker is no webp image")
+	}
+	if w != stickerSize || h != stickerSize {
+		return fmt.Errorf("sticker is %dx%d, stickers have to be %dx%d", w, h, stickerSize, stickerSize)
+	}
+
+	msg.Type = "image/webp"
+	msg.Width, msg.Height = uint32(w), uint32(h)
+	return nil
+}
+
+// webpSize returns the size of a WebP image from the header of its first chunk, which is VP8X for extended (e.g.
+// animated) images, VP8L for lossless and VP8 for lossy images.
+func webpSize(data []byte) (w, h int, ok bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+
+	le24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+	switch string(data[12:16]) {
+	case "VP8X":
+		return le24(data[24:27]) + 1, le24(data[27:30]) + 1, true
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8 ":
+		if data[23] != 0x9d || data[24] != 0x01 || data[25] != 0x2a {
+			return 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff), true
+	}
+	return 0, 0, false
+}
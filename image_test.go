@@ -0,0 +1,231 @@
+package whatsapp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+)
+
+// testJpeg returns a w x h jpeg with the given exif orientation. The left half of the image is black, the right half
+// is white.
+func testJpeg(t *testing.T, w, h, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+
+	// big endian tiff header with a single IFD entry for the orientation
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00")
+	exif = append(exif, byte(orientation), 0, 0, 0, 0, 0, 0)
+	app1 := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
+
+func TestJpegOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		if got := jpegOrientation(testJpeg(t, 8, 4, o)); got != o {
+			t.Errorf("orientation %d parsed as %d", o, got)
+		}
+	}
+}
+
+func TestResizeImageMessage(t *testing.T) {
+	msg := ImageMessage{Content: bytes.NewReader(testJpeg(t, 400, 200, 6)), Type: "image/png"}
+	if err := resizeImageMessage(&msg, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(msg.Content)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 50 || b.Dy() != 100 {
+		t.Errorf("unexpected size %dx%d", b.Dx(), b.Dy())
+	}
+	if msg.Type != "image/jpeg" {
+		t.Errorf("unexpected type %q", msg.Type)
+	}
+
+	// rotated clockwise, the black left half is at the top
+	if r, _, _, _ := img.At(25, 10).RGBA(); r > 0x2000 {
+		t.Error("image was not rotated")
+	}
+	if r, _, _, _ := img.At(25, 90).RGBA(); r < 0xe000 {
+		t.Error("image was not rotated")
+	}
+}
+
+func TestResizeImageMessageSmall(t *testing.T) {
+	data := testJpeg(t, 40, 20, 1)
+	msg := ImageMessage{Content: bytes.NewReader(data), Type: "image/jpeg"}
+	if err := resizeImageMessage(&msg, 100); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(msg.Content); !bytes.Equal(content, data) {
+		t.Error("small image was changed")
+	}
+}
+
+func TestResizeImageMessagePng(t *testing.T) {
+	// transparent left half, opaque red right half
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 200; x < 400; x++ {
+			src.Set(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, src); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := ImageMessage{Content: bytes.NewReader(b.Bytes()), Type: "image/png"}
+	if err := resizeImageMessage(&msg, 100); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "image/png" {
+		t.Errorf("unexpected type %q", msg.Type)
+	}
+
+	data, _ := ioutil.ReadAll(msg.Content)
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("unexpected size %dx%d", b.Dx(), b.Dy())
+	}
+	if _, _, _, a := img.At(10, 25).RGBA(); a != 0 {
+		t.Errorf("transparent pixel has alpha %#x", a)
+	}
+	if r, _, _, a := img.At(90, 25).RGBA(); r != 0xffff || a != 0xffff {
+		t.Errorf("unexpected opaque pixel %#x, alpha %#x", r, a)
+	}
+}
+
+func TestResizeImageMessageTooLarge(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	// raise the dimensions in the IHDR chunk to 100000x100000 and fix its checksum
+	data := b.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	msg := ImageMessage{Content: bytes.NewReader(data), Type: "image/png"}
+	if err := resizeImageMessage(&msg, 100); err == nil {
+		t.Fatal("expected an error for an image exceeding maxImagePixels")
+	}
+	if content, _ := ioutil.ReadAll(msg.Content); !bytes.Equal(content, data) {
+		t.Error("refused image was changed")
+	}
+}
+
+func TestBlurImageThumbnail(t *testing.T) {
+	data := testJpeg(t, 400, 200, 1)
+	msg := ImageMessage{Content: bytes.NewReader(data), Type: "image/jpeg"}
+	if err := blurImageThumbnail(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, _ := ioutil.ReadAll(msg.Content); !bytes.Equal(content, data) {
+		t.Error("image content was changed")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(msg.Thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 48 || b.Dy() != 24 {
+		t.Errorf("unexpected size %dx%d", b.Dx(), b.Dy())
+	}
+
+	// the sharp edge between the black and the white half is blurred into a gradient
+	if r, _, _, _ := img.At(24, 12).RGBA(); r < 0x2000 || r > 0xe000 {
+		t.Errorf("edge is not blurred: %x", r)
+	}
+}
+
+func TestBlurImageThumbnailUndecodable(t *testing.T) {
+	wac := &Conn{BlurThumbnails: true}
+	if _, err := wac.BuildProto(ImageMessage{Type: "image/jpeg"}); err != nil {
+		t.Errorf("image without content: %v", err)
+	}
+
+	p, err := wac.BuildProto(ImageMessage{Type: "image/jpeg", Content: bytes.NewReader([]byte("no image"))})
+	if err != nil {
+		t.Fatalf("undecodable image: %v", err)
+	}
+	if p.GetMessage().GetImageMessage().GetJpegThumbnail() != nil {
+		t.Error("thumbnail set for undecodable image")
+	}
+}
+
+func TestGenerateImageThumbnail(t *testing.T) {
+	data := testJpeg(t, 400, 200, 1)
+	msg := ImageMessage{Content: bytes.NewReader(data), Type: "image/jpeg"}
+	if err := generateImageThumbnail(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, _ := ioutil.ReadAll(msg.Content); !bytes.Equal(content, data) {
+		t.Error("image content was changed")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(msg.Thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("unexpected size %dx%d", b.Dx(), b.Dy())
+	}
+
+	msg = ImageMessage{Content: bytes.NewReader([]byte("no image")), Type: "image/jpeg"}
+	if err := generateImageThumbnail(&msg); err != nil || msg.Thumbnail != nil {
+		t.Errorf("unexpected thumbnail %v or error %v for undecodable content", msg.Thumbnail, err)
+	}
+}
+
+// testWebp returns the header of a w x h lossless WebP image, which is all validateSticker reads.
+func testWebp(w, h int) []byte {
+	bits := uint32(w-1) | uint32(h-1)<<14
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8L\x00\x00\x00\x00\x2f")
+	return append(data, byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24), 0, 0, 0, 0, 0)
+}
+
+func TestValidateSticker(t *testing.T) {
+	msg := StickerMessage{Content: bytes.NewReader(testWebp(512, 512))}
+	if err := validateSticker(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "image/webp" || msg.Width != 512 || msg.Height != 512 {
+		t.Errorf("unexpected sticker %+v", msg)
+	}
+	if content, _ := ioutil.ReadAll(msg.Content); !bytes.Equal(content, testWebp(512, 512)) {
+		t.Error("sticker content was changed")
+	}
+
+	for _, content := range [][]byte{testWebp(512, 256), testJpeg(t, 512, 512, 1)} {
+		msg := StickerMessage{Content: bytes.NewReader(content)}
+		if err := validateSticker(&msg); err == nil {
+			t.Error("no error for invalid sticker")
+		}
+	}
+}
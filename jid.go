@@ -0,0 +1,125 @@
+package whatsapp
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+WhatsApp addresses users and chats with JIDs of the form <user>@<server>. Users are addressed by their phone number on
+the s.whatsapp.net server (c.us in older parts of the protocol), groups on g.us. Newer WhatsApp versions additionally
+address users by a LinkedID on the lid server, which hides the phone number of the user. A LID can not be converted to
+a phone number JID, so LID addresses are passed through the package unchanged. Channels (newsletters) are addressed on
+the newsletter server, broadcast lists and the status updates (status@broadcast) on the broadcast server.
+*/
+const (
+	userServer       = "s.whatsapp.net"
+	legacyUserServer = "c.us"
+	groupServer      = "g.us"
+	lidServer        = "lid"
+	newsletterServer = "newsletter"
+	broadcastServer  = "broadcast"
+)
+
+/*
+NewUserJID returns the JID of the user with the phone number phone, which has to be given in international format
+with country code. A leading +, spaces and dashes are removed, e.g. "+1 555-123-4567" becomes
+"15551234567@s.whatsapp.net". Numbers that contain other characters or are too short or too long to be valid are
+rejected. NewUserJID does not check whether the number is registered at WhatsApp, see CheckContacts for that.
+*/
+func NewUserJID(phone string) (string, error) {
+	number := strings.NewReplacer("+", "", " ", "", "-", "").Replace(phone)
+
+	// numbers in international format have at most 15 digits
+	if len(number) < 5 || len(number) > 15 {
+		return "", fmt.Errorf("invalid phone number %q: expected 5 to 15 digits", phone)
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("invalid phone number %q: unexpected character %q", phone, c)
+		}
+	}
+	return number + "@" + userServer, nil
+}
+
+/*
+NewGroupJID returns the JID of the group with the id id, e.g. "491234567890-1600000000@g.us" for the id
+"491234567890-1600000000". Ids that already are group JIDs are returned unchanged.
+*/
+func NewGroupJID(id string) string {
+	if strings.HasSuffix(id, "@"+groupServer) {
+		return id
+	}
+	return id + "@" + groupServer
+}
+
+/*
+ValidateJID checks that jid is a complete address of a user, group, broadcast or channel. The user part of user JIDs
+has to consist of digits only, the one of group JIDs of digits with an optional "-" between the creator and the
+creation time. Send rejects messages to malformed JIDs with the error of ValidateJID, the most common mistake is to pass
+a bare phone number, which NewUserJID converts to a JID.
+*/
+func ValidateJID(jid string) error {
+	if jid == "" {
+		return fmt.Errorf("invalid jid: jid is empty")
+	}
+
+	i := strings.LastIndex(jid, "@")
+	if i < 0 {
+		return fmt.Errorf("invalid jid %q: missing @<server>, use NewUserJID for phone numbers", jid)
+	}
+	if i == 0 {
+		return fmt.Errorf("invalid jid %q: missing user", jid)
+	}
+
+	switch server := jid[i+1:]; server {
+	case userServer, legacyUserServer:
+		if !isJidNumber(jid[:i]) {
+			return fmt.Errorf("invalid jid %q: user has to be a phone number, use NewUserJID to convert it", jid)
+		}
+	case groupServer:
+		for _, part := range strings.SplitN(jid[:i], "-", 2) {
+			if !isJidNumber(part) {
+				return fmt.Errorf("invalid jid %q: malformed group id", jid)
+			}
+		}
+	case lidServer, newsletterServer, broadcastServer:
+	default:
+		return fmt.Errorf("invalid jid %q: unknown server %q", jid, server)
+	}
+	return nil
+}
+
+// isJidNumber reports whether s is a non-empty string of digits.
+func isJidNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+/*
+IsLIDJID reports whether jid is a LinkedID address (<id>@lid) instead of a phone number based JID.
+*/
+func IsLIDJID(jid string) bool {
+	return strings.HasSuffix(jid, "@"+lidServer)
+}
+
+/*
+IsNewsletterJID reports whether jid is the address of a channel (<id>@newsletter). Channels are only available in the
+multi-device protocol, messages of channels are not received and Send refuses to send to channels.
+*/
+func IsNewsletterJID(jid string) bool {
+	return strings.HasSuffix(jid, "@"+newsletterServer)
+}
+
+// normalizeJid rewrites the legacy c.us user server to s.whatsapp.net. All other addresses, including LIDs, are
+// returned unchanged.
+func normalizeJid(jid string) string {
+	if strings.HasSuffix(jid, "@"+legacyUserServer) {
+		return strings.TrimSuffix(jid, legacyUserServer) + userServer
+	}
+	return jid
+}
@@ -0,0 +1,63 @@
+package whatsapp
+
+import "testing"
+
+func TestNewUserJID(t *testing.T) {
+	for phone, jid := range map[string]string{
+		"15551234567":     "15551234567@s.whatsapp.net",
+		"+1 555-123-4567": "15551234567@s.whatsapp.net",
+		"+49 1234 567890": "491234567890@s.whatsapp.net",
+	} {
+		if got, err := NewUserJID(phone); err != nil || got != jid {
+			t.Errorf("NewUserJID(%q) = %q, %v, expected %q", phone, got, err, jid)
+		}
+	}
+
+	for _, phone := range []string{"", "+1", "(555) 123-4567", "15551234567@s.whatsapp.net", "1234567890123456"} {
+		if jid, err := NewUserJID(phone); err == nil {
+			t.Errorf("NewUserJID(%q) = %q, expected an error", phone, jid)
+		}
+	}
+}
+
+func TestNewGroupJID(t *testing.T) {
+	if jid := NewGroupJID("491234567890-1600000000"); jid != "491234567890-1600000000@g.us" {
+		t.Errorf("unexpected group jid %q", jid)
+	}
+	if jid := NewGroupJID("491234567890-1600000000@g.us"); jid != "491234567890-1600000000@g.us" {
+		t.Errorf("group jid changed to %q", jid)
+	}
+}
+
+func TestValidateJID(t *testing.T) {
+	for _, jid := range []string{
+		"491234567890@s.whatsapp.net",
+		"491234567890@c.us",
+		"491234567890-1600000000@g.us",
+		"120363012345678901@g.us",
+		"123456789@lid",
+		"123456789@newsletter",
+		"status@broadcast",
+	} {
+		if err := ValidateJID(jid); err != nil {
+			t.Errorf("valid jid %q rejected: %v", jid, err)
+		}
+	}
+
+	for _, jid := range []string{
+		"",
+		"491234567890",
+		"@s.whatsapp.net",
+		"491234567890@whatsapp.net",
+		"491234567890@",
+		"+49 123@s.whatsapp.net",
+		"49-1234567890@c.us",
+		"group@g.us",
+		"491234567890-@g.us",
+		"491234567890-1600000000-1@g.us",
+	} {
+		if err := ValidateJID(jid); err == nil {
+			t.Errorf("invalid jid %q accepted", jid)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package whatsapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonMessage is the envelope of UnmarshalMessage and MarshalMessage. Byte slices are base64 encoded in json.
+type jsonMessage struct {
+	Type              string          `json:"type"`
+	Id                string          `json:"id,omitempty"`
+	RemoteJid         string          `json:"remoteJid"`
+	SenderJid         string          `json:"senderJid,omitempty"`
+	FromMe            bool            `json:"fromMe,omitempty"`
+	Timestamp         uint64          `json:"timestamp,omitempty"`
+	PushName          string          `json:"pushName,omitempty"`
+	Status            MessageStatus   `json:"status,omitempty"`
+	QuotedMessageID   string          `json:"quotedMessageId,omitempty"`
+	QuotedParticipant string          `json:"quotedParticipant,omitempty"`
+	QuotedMessage     json.RawMessage `json:"quotedMessage,omitempty"`
+	MentionedJids     []string        `json:"mentionedJids,omitempty"`
+	SenderPlatform    Platform        `json:"senderPlatform,omitempty"`
+	Conversion        *jsonConversion `json:"conversion,omitempty"`
+	Labels            []string        `json:"labels,omitempty"`
+
+	Text            string           `json:"text,omitempty"`
+	LinkPreview     *jsonLinkPreview `json:"linkPreview,omitempty"`
+	Caption         string           `json:"caption,omitempty"`
+	Title           string           `json:"title,omitempty"`
+	Mimetype        string           `json:"mimetype,omitempty"`
+	Length          uint32           `json:"length,omitempty"`
+	PageCount       uint32           `json:"pageCount,omitempty"`
+	GifPlayback     bool             `json:"gifPlayback,omitempty"`
+	Width           uint32           `json:"width,omitempty"`
+	Height          uint32           `json:"height,omitempty"`
+	ThumbnailBase64 []byte           `json:"thumbnailBase64,omitempty"`
+	ContentBase64   []byte           `json:"contentBase64,omitempty"`
+
+	Url           string `json:"url,omitempty"`
+	MediaKey      []byte `json:"mediaKey,omitempty"`
+	FileEncSha256 []byte `json:"fileEncSha256,omitempty"`
+	FileSha256    []byte `json:"fileSha256,omitempty"`
+	FileLength    uint64 `json:"fileLength,omitempty"`
+
+	DisplayName string        `json:"displayName,omitempty"`
+	Vcard       string        `json:"vcard,omitempty"`
+	Contacts    []jsonContact `json:"contacts,omitempty"`
+
+	DegreesLatitude                   float64 `json:"degreesLatitude,omitempty"`
+	DegreesLongitude                  float64 `json:"degreesLongitude,omitempty"`
+	Name                              string  `json:"name,omitempty"`
+	Address                           string  `json:"address,omitempty"`
+	AccuracyInMeters                  uint32  `json:"accuracyInMeters,omitempty"`
+	SpeedInMps                        float32 `json:"speedInMps,omitempty"`
+	DegreesClockwiseFromMagneticNorth uint32  `json:"degreesClockwiseFromMagneticNorth,omitempty"`
+	SequenceNumber                    int64   `json:"sequenceNumber,omitempty"`
+
+	Namespace   string   `json:"namespace,omitempty"`
+	ElementName string   `json:"elementName,omitempty"`
+	Params      []string `json:"params,omitempty"`
+	FallbackLg  string   `json:"fallbackLg,omitempty"`
+	FallbackLc  string   `json:"fallbackLc,omitempty"`
+
+	RevokedMessageID string `json:"revokedMessageId,omitempty"`
+}
+
+type jsonConversion struct {
+	Source       string `json:"source,omitempty"`
+	Data         []byte `json:"data,omitempty"`
+	DelaySeconds uint32 `json:"delaySeconds,omitempty"`
+}
+
+type jsonLinkPreview struct {
+	MatchedText     string `json:"matchedText,omitempty"`
+	CanonicalUrl    string `json:"canonicalUrl,omitempty"`
+	Title           string `json:"title,omitempty"`
+	Description     string `json:"description,omitempty"`
+	ThumbnailBase64 []byte `json:"thumbnailBase64,omitempty"`
+}
+
+type jsonContact struct {
+	DisplayName string `json:"displayName,omitempty"`
+	Vcard       string `json:"vcard,omitempty"`
+}
+
+/*
+UnmarshalMessage builds a message that can be passed to Send from a json object, e.g. one received by a webhook. The
+"type" field selects the message type and is one of "text", "image", "video", "audio", "document", "sticker",
+"contact", "contactsArray", "location", "liveLocation", "template", "revoked" or "placeholder". "remoteJid" is required
+for all types, "text" for text messages, "contentBase64" and "mimetype" for media messages. The other fields are
+optional:
+
+	{"type": "text", "remoteJid": "...", "text": "...", "id": "..."}
+	{"type": "image", "remoteJid": "...", "mimetype": "image/jpeg", "contentBase64": "...", "caption": "...", "thumbnailBase64": "..."}
+	{"type": "video", "remoteJid": "...", "mimetype": "video/mp4", "contentBase64": "...", "caption": "...", "thumbnailBase64": "...", "length": 10}
+	{"type": "audio", "remoteJid": "...", "mimetype": "audio/ogg; codecs=opus", "contentBase64": "...", "length": 10}
+	{"type": "document", "remoteJid": "...", "mimetype": "application/pdf", "contentBase64": "...", "title": "...", "pageCount": 1, "thumbnailBase64": "..."}
+	{"type": "contact", "remoteJid": "...", "displayName": "...", "vcard": "..."}
+	{"type": "location", "remoteJid": "...", "degreesLatitude": 52.52, "degreesLongitude": 13.40, "name": "...", "address": "..."}
+
+The returned message is a value of one of the message types of the package, e.g. TextMessage. The json written by
+MarshalMessage is accepted as well. Media messages that only reference their media by "url" and "mediaKey" instead of
+containing it can be downloaded, but not sent.
+*/
+func UnmarshalMessage(data []byte) (interface{}, error) {
+	return unmarshalMessage(data, true)
+}
+
+// unmarshalMessage is UnmarshalMessage. Media messages without media are only accepted if requireMedia is not set.
+func unmarshalMessage(data []byte, requireMedia bool) (interface{}, error) {
+	var m jsonMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding message: %v", err)
+	}
+
+	if m.RemoteJid == "" {
+		return nil, fmt.Errorf("message has no remoteJid")
+	}
+	info := MessageInfo{
+		Id:                m.Id,
+		RemoteJid:         m.RemoteJid,
+		SenderJid:         m.SenderJid,
+		FromMe:            m.FromMe,
+		Timestamp:         m.Timestamp,
+		PushName:          m.PushName,
+		Status:            m.Status,
+		QuotedMessageID:   m.QuotedMessageID,
+		QuotedParticipant: m.QuotedParticipant,
+		MentionedJids:     m.MentionedJids,
+		SenderPlatform:    m.SenderPlatform,
+		Labels:            m.Labels,
+	}
+	if len(m.QuotedMessage) > 0 {
+		quoted, err := unmarshalMessage(m.QuotedMessage, false)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding quoted message: %v", err)
+		}
+		info.QuotedMessage = quoted
+	}
+	if c := m.Conversion; c != nil {
+		info.Conversion = &Conversion{Source: c.Source, Data: c.Data, DelaySeconds: c.DelaySeconds}
+	}
+
+	switch m.Type {
+	case "text":
+		if m.Text == "" {
+			return nil, fmt.Errorf("text message has no text")
+		}
+		msg := TextMessage{Info: info, Text: m.Text}
+		if p := m.LinkPreview; p != nil {
+			msg.LinkPreview = &LinkPreview{MatchedText: p.MatchedText, CanonicalUrl: p.CanonicalUrl, Title: p.Title,
+				Description: p.Description, Thumbnail: p.ThumbnailBase64}
+		}
+		return msg, nil
+	case "contact":
+		return ContactMessage{Info: info, DisplayName: m.DisplayName, Vcard: m.Vcard}, nil
+	case "contactsArray":
+		msg := ContactsArrayMessage{Info: info, DisplayName: m.DisplayName}
+		for _, c := range m.Contacts {
+			msg.Contacts = append(msg.Contacts, ContactMessage{DisplayName: c.DisplayName, Vcard: c.Vcard})
+		}
+		return msg, nil
+	case "location":
+		return LocationMessage{Info: info, DegreesLatitude: m.DegreesLatitude, DegreesLongitude: m.DegreesLongitude,
+			Name: m.Name, Address: m.Address, Url: m.Url, Thumbnail: m.ThumbnailBase64}, nil
+	case "liveLocation":
+		return LiveLocationMessage{Info: info, DegreesLatitude: m.DegreesLatitude, DegreesLongitude: m.DegreesLongitude,
+			AccuracyInMeters: m.AccuracyInMeters, SpeedInMps: m.SpeedInMps,
+			DegreesClockwiseFromMagneticNorth: m.DegreesClockwiseFromMagneticNorth, Caption: m.Caption,
+			SequenceNumber: m.SequenceNumber, Thumbnail: m.ThumbnailBase64}, nil
+	case "template":
+		return TemplateMessage{Info: info, Namespace: m.Namespace, ElementName: m.ElementName, Params: m.Params,
+			FallbackLg: m.FallbackLg, FallbackLc: m.FallbackLc}, nil
+	case "revoked":
+		return RevokedMessage{Info: info, RevokedMessageID: m.RevokedMessageID}, nil
+	case "placeholder":
+		return PlaceholderMessage{Info: info}, nil
+	case "image", "video", "audio", "document", "sticker":
+	case "":
+		return nil, fmt.Errorf("message has no type")
+	default:
+		return nil, fmt.Errorf("unknown message type %q", m.Type)
+	}
+
+	if requireMedia && len(m.ContentBase64) == 0 && (m.Url == "" || len(m.MediaKey) == 0) {
+		return nil, fmt.Errorf("%s message has no contentBase64", m.Type)
+	}
+	if m.Mimetype == "" {
+		return nil, fmt.Errorf("%s message has no mimetype", m.Type)
+	}
+	var content io.Reader
+	if len(m.ContentBase64) > 0 {
+		content = bytes.NewReader(m.ContentBase64)
+	}
+
+	switch m.Type {
+	case "image":
+		return ImageMessage{Info: info, Caption: m.Caption, Thumbnail: m.ThumbnailBase64, Type: m.Mimetype, Content: content,
+			url: m.Url, mediaKey: m.MediaKey, fileEncSha256: m.FileEncSha256, fileSha256: m.FileSha256, fileLength: m.FileLength}, nil
+	case "video":
+		return VideoMessage{Info: info, Caption: m.Caption, Thumbnail: m.ThumbnailBase64, Length: m.Length, Type: m.Mimetype, Content: content,
+			url: m.Url, mediaKey: m.MediaKey, fileEncSha256: m.FileEncSha256, fileSha256: m.FileSha256, fileLength: m.FileLength,
+			GifPlayback: m.GifPlayback}, nil
+	case "audio":
+		return AudioMessage{Info: info, Length: m.Length, Type: m.Mimetype, Content: content,
+			url: m.Url, mediaKey: m.MediaKey, fileEncSha256: m.FileEncSha256, fileSha256: m.FileSha256, fileLength: m.FileLength}, nil
+	case "sticker":
+		return StickerMessage{Info: info, Thumbnail: m.ThumbnailBase64, Type: m.Mimetype, Width: m.Width, Height: m.Height, Content: content,
+			url: m.Url, mediaKey: m.MediaKey, fileEncSha256: m.FileEncSha256, fileSha256: m.FileSha256, fileLength: m.FileLength}, nil
+	default:
+		return DocumentMessage{Info: info, Title: m.Title, PageCount: m.PageCount, Type: m.Mimetype, Thumbnail: m.ThumbnailBase64, Content: content,
+			url: m.Url, mediaKey: m.MediaKey, fileEncSha256: m.FileEncSha256, fileSha256: m.FileSha256, fileLength: m.FileLength}, nil
+	}
+}
+
+/*
+MarshalMessage encodes a message of one of the message types of the package as json, e.g. to store received messages.
+The json contains the "type" of the message, the fields of its MessageInfo except the Source and the fields of the
+message type in the format of UnmarshalMessage. A QuotedMessage is encoded as nested message in "quotedMessage", it is
+left out if it is not of a message type of the package. Media is not embedded, it is referenced by "url", "mediaKey",
+"fileEncSha256", "fileSha256" and "fileLength", so it can still be downloaded after UnmarshalMessage as long as it is
+available on the WhatsApp servers.
+*/
+func MarshalMessage(msg interface{}) ([]byte, error) {
+	return marshalMessage(msg, true)
+}
+
+// marshalMessage is MarshalMessage. The media key and hashes of media messages are only included if withKeys is set.
+func marshalMessage(msg interface{}, withKeys bool) ([]byte, error) {
+	m, err := getJsonMessage(msg, withKeys)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// getJsonMessage returns the envelope of msg for marshalMessage.
+func getJsonMessage(msg interface{}, withKeys bool) (jsonMessage, error) {
+	var m jsonMessage
+	var info MessageInfo
+
+	switch v := msg.(type) {
+	case TextMessage:
+		m = jsonMessage{Type: "text", Text: v.Text}
+		if p := v.LinkPreview; p != nil {
+			m.LinkPreview = &jsonLinkPreview{MatchedText: p.MatchedText, CanonicalUrl: p.CanonicalUrl, Title: p.Title,
+				Description: p.Description, ThumbnailBase64: p.Thumbnail}
+		}
+		info = v.Info
+	case ImageMessage:
+		m = jsonMessage{Type: "image", Caption: v.Caption, ThumbnailBase64: v.Thumbnail, Mimetype: v.Type,
+			Url: v.url, MediaKey: v.mediaKey, FileEncSha256: v.fileEncSha256, FileSha256: v.fileSha256, FileLength: v.fileLength}
+		info = v.Info
+	case VideoMessage:
+		m = jsonMessage{Type: "video", Caption: v.Caption, ThumbnailBase64: v.Thumbnail, Length: v.Length, Mimetype: v.Type,
+			Url: v.url, MediaKey: v.mediaKey, FileEncSha256: v.fileEncSha256, FileSha256: v.fileSha256, FileLength: v.fileLength,
+			GifPlayback: v.GifPlayback}
+		info = v.Info
+	case AudioMessage:
+		m = jsonMessage{Type: "audio", Length: v.Length, Mimetype: v.Type,
+			Url: v.url, MediaKey: v.mediaKey, FileEncSha256: v.fileEncSha256, FileSha256: v.fileSha256, FileLength: v.fileLength}
+		info = v.Info
+	case DocumentMessage:
+		m = jsonMessage{Type: "document", Title: v.Title, PageCount: v.PageCount, Mimetype: v.Type, ThumbnailBase64: v.Thumbnail,
+			Url: v.url, MediaKey: v.mediaKey, FileEncSha256: v.fileEncSha256, FileSha256: v.fileSha256, FileLength: v.fileLength}
+		info = v.Info
+	case StickerMessage:
+		m = jsonMessage{Type: "sticker", ThumbnailBase64: v.Thumbnail, Mimetype: v.Type, Width: v.Width, Height: v.Height,
+			Url: v.url, MediaKey: v.mediaKey, FileEncSha256: v.fileEncSha256, FileSha256: v.fileSha256, FileLength: v.fileLength}
+		info = v.Info
+	case ContactMessage:
+		m = jsonMessage{Type: "contact", DisplayName: v.DisplayName, Vcard: v.Vcard}
+		info = v.Info
+	case ContactsArrayMessage:
+		m = jsonMessage{Type: "contactsArray", DisplayName: v.DisplayName}
+		for _, c := range v.Contacts {
+			m.Contacts = append(m.Contacts, jsonContact{DisplayName: c.DisplayName, Vcard: c.Vcard})
+		}
+		info = v.Info
+	case LocationMessage:
+		m = jsonMessage{Type: "location", DegreesLatitude: v.DegreesLatitude, DegreesLongitude: v.DegreesLongitude,
+			Name: v.Name, Address: v.Address, Url: v.Url, ThumbnailBase64: v.Thumbnail}
+		info = v.Info
+	case LiveLocationMessage:
+		m = jsonMessage{Type: "liveLocation", DegreesLatitude: v.DegreesLatitude, DegreesLongitude: v.DegreesLongitude,
+			AccuracyInMeters: v.AccuracyInMeters, SpeedInMps: v.SpeedInMps,
+			DegreesClockwiseFromMagneticNorth: v.DegreesClockwiseFromMagneticNorth, Caption: v.Caption,
+			SequenceNumber: v.SequenceNumber, ThumbnailBase64: v.Thumbnail}
+		info = v.Info
+	case TemplateMessage:
+		m = jsonMessage{Type: "template", Namespace: v.Namespace, ElementName: v.ElementName, Params: v.Params,
+			FallbackLg: v.FallbackLg, FallbackLc: v.FallbackLc}
+		info = v.Info
+	case RevokedMessage:
+		m = jsonMessage{Type: "revoked", RevokedMessageID: v.RevokedMessageID}
+		info = v.Info
+	case PlaceholderMessage:
+		m = jsonMessage{Type: "placeholder"}
+		info = v.Info
+	default:
+		return jsonMessage{}, fmt.Errorf("cannot match type %T, use message types declared in the package", msg)
+	}
+
+	m.Id = info.Id
+	m.RemoteJid = info.RemoteJid
+	m.SenderJid = info.SenderJid
+	m.FromMe = info.FromMe
+	m.Timestamp = info.Timestamp
+	m.PushName = info.PushName
+	m.Status = info.Status
+	m.QuotedMessageID = info.QuotedMessageID
+	m.QuotedParticipant = info.QuotedParticipant
+	m.MentionedJids = info.MentionedJids
+	m.SenderPlatform = info.SenderPlatform
+	m.Labels = info.Labels
+	if c := info.Conversion; c != nil {
+		m.Conversion = &jsonConversion{Source: c.Source, Data: c.Data, DelaySeconds: c.DelaySeconds}
+	}
+	if info.QuotedMessage != nil {
+		// quoted messages of unknown types are left out, the quote is still referenced by QuotedMessageID
+		if quoted, err := marshalMessage(info.QuotedMessage, withKeys); err == nil {
+			m.QuotedMessage = quoted
+		}
+	}
+	if !withKeys {
+		m.MediaKey, m.FileEncSha256, m.FileSha256 = nil, nil, nil
+	}
+
+	return m, nil
+}
+
+// MarshalJSON encodes the message like MarshalMessage, but without its content, media key and hashes.
+func (m ImageMessage) MarshalJSON() ([]byte, error) {
+	return marshalMediaJSON(m)
+}
+
+// UnmarshalJSON decodes an image message written by MarshalJSON or MarshalMessage.
+func (m *ImageMessage) UnmarshalJSON(data []byte) error {
+	return unmarshalMediaMessage(data, m)
+}
+
+// MarshalJSON encodes the message like MarshalMessage, but without its content, media key and hashes.
+func (m VideoMessage) MarshalJSON() ([]byte, error) {
+	return marshalMediaJSON(m)
+}
+
+// UnmarshalJSON decodes a video message written by MarshalJSON or MarshalMessage.
+func (m *VideoMessage) UnmarshalJSON(data []byte) error {
+	return unmarshalMediaMessage(data, m)
+}
+
+// MarshalJSON encodes the message like MarshalMessage, but without its content, media key and hashes.
+func (m AudioMessage) MarshalJSON() ([]byte, error) {
+	return marshalMediaJSON(m)
+}
+
+// UnmarshalJSON decodes an audio message written by MarshalJSON or MarshalMessage.
+func (m *AudioMessage) UnmarshalJSON(data []byte) error {
+	return unmarshalMediaMessage(data, m)
+}
+
+// MarshalJSON encodes the message like MarshalMessage, but without its content, media key and hashes.
+func (m DocumentMessage) MarshalJSON() ([]byte, error) {
+	return marshalMediaJSON(m)
+}
+
+// UnmarshalJSON decodes a document message written by MarshalJSON or MarshalMessage.
+func (m *DocumentMessage) UnmarshalJSON(data []byte) error {
+	return unmarshalMediaMessage(data, m)
+}
+
+// marshalMediaJSON implements MarshalJSON of the media messages. It encodes msg like MarshalMessage, but without the
+// media key and hashes, so messages can be written to logs without giving access to their media. Content is omitted as
+// well. Messages decoded from this json can not be downloaded, use MarshalMessage to store messages that have to be
+// downloaded later on.
+func marshalMediaJSON(msg interface{}) ([]byte, error) {
+	return marshalMessage(msg, false)
+}
+
+// unmarshalMediaMessage decodes data with UnmarshalMessage into msg, which has to be a pointer to a message of the
+// same type.
+func unmarshalMediaMessage(data []byte, msg interface{}) error {
+	decoded, err := unmarshalMessage(data, false)
+	if err != nil {
+		return err
+	}
+
+	switch m := msg.(type) {
+	case *ImageMessage:
+		if v, ok := decoded.(ImageMessage); ok {
+			*m = v
+			return nil
+		}
+	case *VideoMessage:
+		if v, ok := decoded.(VideoMessage); ok {
+			*m = v
+			return nil
+		}
+	case *AudioMessage:
+		if v, ok := decoded.(AudioMessage); ok {
+			*m = v
+			return nil
+		}
+	case *DocumentMessage:
+		if v, ok := decoded.(DocumentMessage); ok {
+			*m = v
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot decode %T into %T", decoded, msg)
+}
@@ -0,0 +1,177 @@
+package whatsapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalMessage(t *testing.T) {
+	msg, err := UnmarshalMessage([]byte(`{"type": "image", "remoteJid": "123@s.whatsapp.net", "caption": "hi", "mimetype": "image/jpeg", "contentBase64": "aW1hZ2U="}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, ok := msg.(ImageMessage)
+	if !ok {
+		t.Fatalf("unmarshaled as %T", msg)
+	}
+	if img.Info.RemoteJid != "123@s.whatsapp.net" || img.Caption != "hi" || img.Type != "image/jpeg" {
+		t.Errorf("unexpected message %+v", img)
+	}
+	if content, _ := ioutil.ReadAll(img.Content); string(content) != "image" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestUnmarshalMessageInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"type": "text", "text": "hi"}`,
+		`{"type": "text", "remoteJid": "123@s.whatsapp.net"}`,
+		`{"type": "sticker", "remoteJid": "123@s.whatsapp.net"}`,
+		`{"remoteJid": "123@s.whatsapp.net", "text": "hi"}`,
+		`{"type": "image", "remoteJid": "123@s.whatsapp.net", "contentBase64": "aW1hZ2U="}`,
+		`{"type": "image", "remoteJid": "123@s.whatsapp.net", "mimetype": "image/jpeg", "contentBase64": "!"}`,
+	} {
+		if _, err := UnmarshalMessage([]byte(data)); err == nil {
+			t.Errorf("no error for %s", data)
+		}
+	}
+}
+
+func TestMarshalMessageRoundTrip(t *testing.T) {
+	data := []byte("image")
+	mediaKey, file := encryptTestMedia(t, data, MediaImage)
+	url := serveTestMedia(t, file)
+
+	img := ImageMessage{
+		Info:       MessageInfo{Id: "ID", RemoteJid: "123@s.whatsapp.net", Timestamp: 1, Status: Read},
+		Caption:    "hi",
+		Type:       "image/jpeg",
+		url:        url,
+		mediaKey:   mediaKey,
+		fileLength: uint64(len(data)),
+	}
+	j, err := MarshalMessage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := UnmarshalMessage(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := msg.(ImageMessage)
+	if !ok {
+		t.Fatalf("unmarshaled as %T", msg)
+	}
+	if restored.Info.Id != "ID" || restored.Info.Status != Read || restored.Caption != "hi" || restored.Content != nil {
+		t.Errorf("unexpected message %+v", restored)
+	}
+	if content, err := restored.Download(); err != nil || string(content) != string(data) {
+		t.Errorf("unexpected download result %q, %v", content, err)
+	}
+}
+
+func TestMediaMessageJson(t *testing.T) {
+	msg := VideoMessage{
+		Info:       MessageInfo{Id: "ID", RemoteJid: "123@s.whatsapp.net"},
+		Caption:    "clip",
+		Type:       "video/mp4",
+		Content:    strings.NewReader("not marshaled"),
+		url:        "https://mmg.whatsapp.net/v",
+		mediaKey:   []byte{1, 2, 3},
+		fileLength: 42,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "not marshaled") || strings.Contains(string(data), "Content") {
+		t.Errorf("content was marshaled: %s", data)
+	}
+
+	if strings.Contains(string(data), "mediaKey") {
+		t.Errorf("media key was marshaled: %s", data)
+	}
+
+	var decoded VideoMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Info.Id != "ID" || decoded.Caption != "clip" || decoded.url != msg.url || decoded.fileLength != 42 {
+		t.Errorf("unexpected message %+v", decoded)
+	}
+
+	// MarshalMessage keeps the media key, so the media can still be downloaded
+	if data, err = MarshalMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.mediaKey, msg.mediaKey) {
+		t.Errorf("media key %v not restored", decoded.mediaKey)
+	}
+
+	var image ImageMessage
+	if err := json.Unmarshal(data, &image); err == nil {
+		t.Error("video decoded as image")
+	}
+}
+
+func TestMarshalMessageAllTypes(t *testing.T) {
+	info := MessageInfo{
+		Id:                "3EB0123456789ABCDEF012",
+		RemoteJid:         "123-456@g.us",
+		SenderJid:         "491234567890@s.whatsapp.net",
+		Timestamp:         1600000000,
+		PushName:          "Alice",
+		Status:            Read,
+		QuotedMessageID:   "QUOTED",
+		QuotedParticipant: "491111111111@s.whatsapp.net",
+		QuotedMessage:     TextMessage{Info: MessageInfo{Id: "QUOTED", RemoteJid: "123-456@g.us"}, Text: "original"},
+		MentionedJids:     []string{"491111111111@s.whatsapp.net"},
+		SenderPlatform:    PlatformWeb,
+		Conversion:        &Conversion{Source: "FB_Ads", Data: []byte{1, 2}, DelaySeconds: 3},
+		Labels:            []string{"1", "2"},
+	}
+	for _, msg := range []interface{}{
+		TextMessage{Info: info, Text: "see https://example.com", LinkPreview: &LinkPreview{MatchedText: "https://example.com",
+			CanonicalUrl: "https://example.com/", Title: "Example", Description: "An example", Thumbnail: []byte{4}}},
+		ImageMessage{Info: info, Caption: "image", Thumbnail: []byte{1}, Type: "image/jpeg",
+			url: "https://mmg.whatsapp.net/i", mediaKey: []byte{2}, fileEncSha256: []byte{3}, fileSha256: []byte{4}, fileLength: 5},
+		VideoMessage{Info: info, Caption: "gif", Length: 3, Type: "video/mp4", GifPlayback: true,
+			url: "https://mmg.whatsapp.net/v", mediaKey: []byte{2}, fileLength: 5},
+		AudioMessage{Info: info, Length: 10, Type: "audio/ogg; codecs=opus", url: "https://mmg.whatsapp.net/a", mediaKey: []byte{2}},
+		DocumentMessage{Info: info, Title: "doc.pdf", PageCount: 2, Type: "application/pdf", url: "https://mmg.whatsapp.net/d", mediaKey: []byte{2}},
+		StickerMessage{Info: info, Type: "image/webp", Width: 512, Height: 512, url: "https://mmg.whatsapp.net/s", mediaKey: []byte{2}},
+		ContactMessage{Info: info, DisplayName: "Bob", Vcard: "BEGIN:VCARD"},
+		ContactsArrayMessage{Info: info, DisplayName: "2 contacts", Contacts: []ContactMessage{
+			{DisplayName: "Bob", Vcard: "BEGIN:VCARD"}, {DisplayName: "Carol", Vcard: "BEGIN:VCARD"}}},
+		LocationMessage{Info: info, DegreesLatitude: 52.52, DegreesLongitude: 13.4, Name: "Berlin", Address: "Germany",
+			Url: "https://example.com/berlin", Thumbnail: []byte{1}},
+		LiveLocationMessage{Info: info, DegreesLatitude: 52.52, DegreesLongitude: 13.4, AccuracyInMeters: 10, SpeedInMps: 1.5,
+			DegreesClockwiseFromMagneticNorth: 90, Caption: "on my way", SequenceNumber: 7, Thumbnail: []byte{1}},
+		TemplateMessage{Info: info, Namespace: "ns", ElementName: "welcome", Params: []string{"Bob"}, FallbackLg: "en", FallbackLc: "US"},
+		RevokedMessage{Info: info, RevokedMessageID: "REVOKED"},
+		PlaceholderMessage{Info: info},
+	} {
+		data, err := MarshalMessage(msg)
+		if err != nil {
+			t.Errorf("error marshaling %T: %v", msg, err)
+			continue
+		}
+		restored, err := UnmarshalMessage(data)
+		if err != nil {
+			t.Errorf("error unmarshaling %T: %v", msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(restored, msg) {
+			t.Errorf("%T changed by round-trip:\n%+v\n%+v", msg, msg, restored)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package whatsapp
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -19,14 +22,268 @@ import (
 	"time"
 )
 
+/*
+DocumentThumbnailer renders a jpeg thumbnail for the content of a document with the given mimetype. It is set with
+SetDocumentThumbnailer and is used when sending a DocumentMessage without a Thumbnail.
+*/
+type DocumentThumbnailer func(mimetype string, content []byte) ([]byte, error)
+
+// thumbnailDocumentTypes are the document mimetypes WhatsApp shows a first page preview for.
+var thumbnailDocumentTypes = map[string]bool{
+	"application/pdf":    true,
+	"application/msword": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.ms-excel": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.ms-powerpoint":                                             true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+}
+
+/*
+SetDocumentThumbnailer sets the function that renders thumbnails for documents that are sent without a Thumbnail. It is
+only called for pdf and office documents (Word, Excel, PowerPoint and OpenDocument), as WhatsApp shows no preview for
+other types. The package does not render documents itself, without a thumbnailer documents are sent without thumbnail.
+A thumbnail that is rendered beforehand can always be set as DocumentMessage.Thumbnail instead.
+*/
+func (wac *Conn) SetDocumentThumbnailer(thumbnailer DocumentThumbnailer) {
+	wac.documentThumbnailer = thumbnailer
+}
+
+func (wac *Conn) generateDocumentThumbnail(msg *DocumentMessage) error {
+	if wac.documentThumbnailer == nil || msg.Thumbnail != nil || !thumbnailDocumentTypes[msg.Type] {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(msg.Content)
+	if err != nil {
+		return err
+	}
+	msg.Content = bytes.NewReader(data)
+
+	msg.Thumbnail, err = wac.documentThumbnailer(msg.Type, data)
+	return err
+}
+
+/*
+DefaultMaxMediaSize is the maximum file length in bytes of media downloaded with the package level download functions
+and the Download methods of the message types, which have no connection to take Conn.MaxMediaSize from. Media that is
+announced larger is rejected with ErrMediaTooLarge before it is downloaded. It is also the default of
+Conn.MaxMediaSize. Zero disables the limit.
+*/
+var DefaultMaxMediaSize int64 = 100 << 20
+
 func Download(url string, mediaKey []byte, appInfo MediaType, fileLength int) ([]byte, error) {
+	return download(http.DefaultClient, url, mediaKey, appInfo, fileLength, DefaultMaxMediaSize)
+}
+
+/*
+DownloadMedia downloads, validates and decrypts the media of msg like Download, using the MediaClient of the connection.
+msg can be an ImageMessage, VideoMessage, AudioMessage, DocumentMessage or StickerMessage, or a pointer to one of them.
+Media larger than MaxMediaSize is rejected with ErrMediaTooLarge before it is downloaded.
+*/
+func (wac *Conn) DownloadMedia(msg interface{}) ([]byte, error) {
+	m, fileLength, err := getMediaFields(msg)
+	if err != nil {
+		return nil, err
+	}
+	return download(wac.mediaClient(), m.url, m.mediaKey, m.appInfo, fileLength, wac.MaxMediaSize)
+}
+
+/*
+DownloadMediaToWriter downloads the media of msg to w like DownloadToWriter, using the MediaClient and the MaxMediaSize
+of the connection. msg can be any of the message types DownloadMedia accepts.
+*/
+func (wac *Conn) DownloadMediaToWriter(w io.Writer, msg interface{}) (int64, error) {
+	m, fileLength, err := getMediaFields(msg)
+	if err != nil {
+		return 0, err
+	}
+	return downloadToWriter(wac.mediaClient(), w, m.url, m.mediaKey, m.appInfo, fileLength, wac.MaxMediaSize)
+}
+
+/*
+DownloadEncryptedMedia retrieves the encrypted media blob of msg like DownloadEncrypted, using the MediaClient and the
+MaxMediaSize of the connection. msg can be any of the message types DownloadMedia accepts.
+*/
+func (wac *Conn) DownloadEncryptedMedia(msg interface{}) ([]byte, error) {
+	m, _, err := getMediaFields(msg)
+	if err != nil {
+		return nil, err
+	}
+	return downloadEncrypted(wac.mediaClient(), m.url, m.fileEncSha256, wac.MaxMediaSize)
+}
+
+/*
+MediaAvailable checks whether the media of msg can still be downloaded like the package level MediaAvailable, using the
+MediaClient of the connection. msg can be any of the message types DownloadMedia accepts.
+*/
+func (wac *Conn) MediaAvailable(msg interface{}) (bool, error) {
+	m, _, err := getMediaFields(msg)
+	if err != nil {
+		return false, err
+	}
+	return mediaAvailable(wac.mediaClient(), m.url)
+}
+
+// mediaFields are the fields of a media message needed to download its media.
+type mediaFields struct {
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileLength    uint64
+	appInfo       MediaType
+}
+
+// getMediaFields returns the media fields of msg, which is a media message or a pointer to one, together with its
+// file length as int. File lengths that do not fit into an int are rejected with ErrMediaTooLarge.
+func getMediaFields(msg interface{}) (mediaFields, int, error) {
+	var m mediaFields
+	switch v := msg.(type) {
+	case ImageMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaImage}
+	case *ImageMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaImage}
+	case VideoMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaVideo}
+	case *VideoMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaVideo}
+	case AudioMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaAudio}
+	case *AudioMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaAudio}
+	case DocumentMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaDocument}
+	case *DocumentMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaDocument}
+	case StickerMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaImage}
+	case *StickerMessage:
+		m = mediaFields{v.url, v.mediaKey, v.fileEncSha256, v.fileLength, MediaImage}
+	default:
+		return m, 0, fmt.Errorf("cannot download media of type %T, use media message types declared in the package", msg)
+	}
+
+	// file lengths that do not fit into an int can not be downloaded
+	if m.fileLength > uint64(^uint(0)>>1) {
+		return m, 0, ErrMediaTooLarge
+	}
+	return m, int(m.fileLength), nil
+}
+
+// checkMediaSize returns ErrMediaTooLarge if fileLength, the length a message claims for its media, exceeds
+// maxMediaSize. Negative lengths are the result of claims that overflow int and are rejected as well.
+func checkMediaSize(fileLength int, maxMediaSize int64) error {
+	if fileLength < 0 || maxMediaSize > 0 && int64(fileLength) > maxMediaSize {
+		return ErrMediaTooLarge
+	}
+	return nil
+}
+
+// detectMimetype sniffs the mimetype of content from its first 512 bytes with http.DetectContentType. It returns a
+// reader with the complete content: seekable content is rewound, so it stays seekable for streaming uploads, other
+// content is returned as the sniffed bytes followed by the rest of content.
+func detectMimetype(content io.Reader) (string, io.Reader, error) {
+	var start int64
+	rs, seekable := content.(io.ReadSeeker)
+	if seekable {
+		var err error
+		if start, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			return "", nil, err
+		}
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	mimetype := http.DetectContentType(head)
+
+	if seekable {
+		if _, err = rs.Seek(start, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		return mimetype, content, nil
+	}
+	return mimetype, io.MultiReader(bytes.NewReader(head), content), nil
+}
+
+// mediaClient returns the http client for media uploads and downloads of the connection.
+func (wac *Conn) mediaClient() *http.Client {
+	if wac.MediaClient != nil {
+		return wac.MediaClient
+	}
+	return http.DefaultClient
+}
+
+// download downloads, validates and decrypts media. Media with a file length larger than maxMediaSize is rejected
+// before the download, the download itself is limited to the size of the encrypted file of fileLength bytes.
+func download(client *http.Client, url string, mediaKey []byte, appInfo MediaType, fileLength int, maxMediaSize int64) ([]byte, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no url present")
+	}
+	if err := checkMediaSize(fileLength, maxMediaSize); err != nil {
+		return nil, err
+	}
+	file, err := downloadEncryptedMedia(client, url, encryptedMediaSize(fileLength))
+	if err != nil {
+		return nil, err
+	}
+	return DecryptMedia(file, mediaKey, appInfo, fileLength)
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media blob as it is stored on the WhatsApp servers, without decrypting it.
+The blob is validated against fileEncSha256, the sha256 hash of the encrypted file that is part of every media
+message. The blob can be decrypted later on with DecryptMedia and the media key of the message, which can be read
+from the message source (e.g. ImageMessage.Info.Source.GetMessage().GetImageMessage().GetMediaKey()). Blobs of media
+larger than DefaultMaxMediaSize are rejected with ErrMediaTooLarge.
+*/
+func DownloadEncrypted(url string, fileEncSha256 []byte) ([]byte, error) {
+	return downloadEncrypted(http.DefaultClient, url, fileEncSha256, DefaultMaxMediaSize)
+}
+
+func downloadEncrypted(client *http.Client, url string, fileEncSha256 []byte, maxMediaSize int64) ([]byte, error) {
 	if url == "" {
 		return nil, fmt.Errorf("no url present")
 	}
-	file, mac, err := downloadMedia(url)
+	if len(fileEncSha256) == 0 {
+		return nil, fmt.Errorf("no encrypted file hash present")
+	}
+	var maxSize int64
+	if maxMediaSize > 0 {
+		maxSize = encryptedMediaSize(int(maxMediaSize))
+	}
+	file, err := downloadEncryptedMedia(client, url, maxSize)
+	if err == ErrMediaSizeMismatch {
+		// without the file length, a larger file can only exceed the maximum size
+		return nil, ErrMediaTooLarge
+	}
 	if err != nil {
 		return nil, err
 	}
+	sha := sha256.Sum256(file)
+	if !bytes.Equal(sha[:], fileEncSha256) {
+		return nil, ErrMediaHashMismatch
+	}
+	return file, nil
+}
+
+/*
+DecryptMedia validates and decrypts an encrypted media blob as returned by DownloadEncrypted. The mediaKey and
+appInfo have to match the message the blob belongs to, fileLength is the length of the decrypted file.
+*/
+func DecryptMedia(file []byte, mediaKey []byte, appInfo MediaType, fileLength int) ([]byte, error) {
+	n := len(file)
+	if n <= 10 {
+		return nil, fmt.Errorf("file to short")
+	}
+	file, mac := file[:n-10], file[n-10:]
+
 	iv, cipherKey, macKey, _, err := getMediaKeys(mediaKey, appInfo)
 	if err != nil {
 		return nil, err
@@ -39,11 +296,116 @@ func Download(url string, mediaKey []byte, appInfo MediaType, fileLength int) ([
 		return nil, err
 	}
 	if len(data) != fileLength {
-		return nil, fmt.Errorf("file length does not match")
+		return nil, ErrMediaSizeMismatch
 	}
 	return data, nil
 }
 
+/*
+DownloadToWriter downloads, validates and decrypts media like Download, but writes the decrypted file to w while it is
+downloaded instead of keeping it in memory. It returns the number of bytes written to w. The mac of the file is only
+known at its end, so if an error is returned, data that was already written to w has to be discarded. The last block of
+the file is only written after the mac was validated. Media larger than DefaultMaxMediaSize is rejected with
+ErrMediaTooLarge.
+*/
+func DownloadToWriter(w io.Writer, url string, mediaKey []byte, appInfo MediaType, fileLength int) (int64, error) {
+	return downloadToWriter(http.DefaultClient, w, url, mediaKey, appInfo, fileLength, DefaultMaxMediaSize)
+}
+
+func downloadToWriter(client *http.Client, w io.Writer, url string, mediaKey []byte, appInfo MediaType, fileLength int, maxMediaSize int64) (int64, error) {
+	if url == "" {
+		return 0, fmt.Errorf("no url present")
+	}
+	if err := checkMediaSize(fileLength, maxMediaSize); err != nil {
+		return 0, err
+	}
+	iv, cipherKey, macKey, _, err := getMediaKeys(mediaKey, appInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	maxSize := encryptedMediaSize(fileLength)
+	body, err := getEncryptedMedia(client, url, maxSize)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := decryptMedia(body, w, iv, cipherKey, macKey, maxSize)
+	if err != nil {
+		return n, err
+	}
+	if n != int64(fileLength) {
+		return n, ErrMediaSizeMismatch
+	}
+	return n, nil
+}
+
+// decryptMedia is the streaming counterpart of DecryptMedia. It decrypts the encrypted file read from r and writes it
+// to w, holding back the mac and the last block, which contains the padding, until the end of the file. Files larger
+// than maxSize bytes are rejected with ErrMediaSizeMismatch.
+func decryptMedia(r io.Reader, w io.Writer, iv, cipherKey, macKey []byte, maxSize int64) (int64, error) {
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return 0, err
+	}
+	decrypter := cipher.NewCBCDecrypter(block, iv)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+
+	const tail = aes.BlockSize + 10
+	var written, read int64
+	buf := make([]byte, 0, 32*1024+tail)
+	for {
+		n, err := io.ReadFull(io.LimitReader(r, maxSize+1-read), buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		read += int64(n)
+		if read > maxSize {
+			return written, ErrMediaSizeMismatch
+		}
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return written, err
+		}
+
+		if k := (len(buf) - tail) / aes.BlockSize * aes.BlockSize; k > 0 {
+			mac.Write(buf[:k])
+			decrypter.CryptBlocks(buf[:k], buf[:k])
+			n, err = w.Write(buf[:k])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			buf = buf[:copy(buf, buf[k:])]
+		}
+		if eof {
+			break
+		}
+	}
+
+	if read <= 10 {
+		return written, fmt.Errorf("file to short")
+	}
+	data, sum := buf[:len(buf)-10], buf[len(buf)-10:]
+	if len(data) != aes.BlockSize {
+		return written, fmt.Errorf("invalid media length")
+	}
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil)[:10], sum) {
+		return written, ErrMediaHashMismatch
+	}
+
+	decrypter.CryptBlocks(data, data)
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > len(data) {
+		return written, fmt.Errorf("invalid media padding")
+	}
+	data = data[:len(data)-padding]
+	n, err := w.Write(data)
+	return written + int64(n), err
+}
+
 func validateMedia(iv []byte, file []byte, macKey []byte, mac []byte) error {
 	h := hmac.New(sha256.New, macKey)
 	n, err := h.Write(append(iv, file...))
@@ -54,7 +416,7 @@ func validateMedia(iv []byte, file []byte, macKey []byte, mac []byte) error {
 		return fmt.Errorf("hash to short")
 	}
 	if !hmac.Equal(h.Sum(nil)[:10], mac) {
-		return fmt.Errorf("invalid media hmac")
+		return ErrMediaHashMismatch
 	}
 	return nil
 }
@@ -64,30 +426,105 @@ func getMediaKeys(mediaKey []byte, appInfo MediaType) (iv, cipherKey, macKey, re
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-	return mediaKeyExpanded[:16], mediaKeyExpanded[16:48], mediaKeyExpanded[48:80], mediaKeyExpanded[80:], nil
+	// cap the slices, appending to iv must not overwrite the other keys
+	return mediaKeyExpanded[:16:16], mediaKeyExpanded[16:48:48], mediaKeyExpanded[48:80:80], mediaKeyExpanded[80:], nil
+}
+
+// isMediaExpiredStatus reports whether the http status code of a media request means that the media was removed.
+func isMediaExpiredStatus(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusGone
+}
+
+/*
+MediaAvailable checks whether the media at url can still be downloaded, without downloading it. It returns
+ErrMediaExpired if the media was removed from the WhatsApp servers.
+*/
+func MediaAvailable(url string) (bool, error) {
+	return mediaAvailable(http.DefaultClient, url)
 }
 
-func downloadMedia(url string) (file []byte, mac []byte, err error) {
-	resp, err := http.Get(url)
+func mediaAvailable(client *http.Client, url string) (bool, error) {
+	if url == "" {
+		return false, fmt.Errorf("no url present")
+	}
+
+	resp, err := client.Head(url)
 	if err != nil {
-		return nil, nil, err
+		return false, err
+	}
+	resp.Body.Close()
+
+	if isMediaExpiredStatus(resp.StatusCode) {
+		return false, ErrMediaExpired
 	}
 	if resp.StatusCode != 200 {
-		return nil, nil, fmt.Errorf("download failed")
+		return false, fmt.Errorf("media request responded with %d", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// encryptedMediaSize returns the size of the encrypted file for a media file of fileLength bytes: the cbc encrypted
+// data, padded to the next full block, followed by the 10 byte mac.
+func encryptedMediaSize(fileLength int) int64 {
+	return int64(fileLength/16+1)*16 + 10
+}
+
+// getEncryptedMedia requests the encrypted file at url and returns the body of the response, which has to be closed by
+// the caller. If maxSize is greater than zero, files that are announced larger than maxSize are rejected with
+// ErrMediaSizeMismatch.
+func getEncryptedMedia(client *http.Client, url string, maxSize int64) (io.ReadCloser, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if isMediaExpiredStatus(resp.StatusCode) {
+		err = ErrMediaExpired
+	} else if resp.StatusCode != 200 {
+		err = fmt.Errorf("download failed")
+	} else if resp.ContentLength >= 0 && resp.ContentLength <= 10 {
+		err = fmt.Errorf("file to short")
+	} else if maxSize > 0 && resp.ContentLength > maxSize {
+		err = ErrMediaSizeMismatch
 	}
-	defer resp.Body.Close()
-	if resp.ContentLength <= 10 {
-		return nil, nil, fmt.Errorf("file to short")
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
 	}
-	data, err := ioutil.ReadAll(resp.Body)
-	n := len(data)
+	return resp.Body, nil
+}
+
+// downloadEncryptedMedia downloads the encrypted file at url. If maxSize is greater than zero, the download is aborted
+// with ErrMediaSizeMismatch as soon as the file is larger than maxSize bytes.
+func downloadEncryptedMedia(client *http.Client, url string, maxSize int64) ([]byte, error) {
+	body, err := getEncryptedMedia(client, url, maxSize)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	defer body.Close()
+	if maxSize <= 0 {
+		return ioutil.ReadAll(body)
 	}
-	return data[:n-10], data[n-10 : n], nil
+
+	file, err := ioutil.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(file)) > maxSize {
+		return nil, ErrMediaSizeMismatch
+	}
+	return file, nil
 }
 
 func (wac *Conn) Upload(reader io.Reader, appInfo MediaType) (url string, mediaKey []byte, fileEncSha256 []byte, fileSha256 []byte, fileLength uint64, err error) {
+	return wac.upload(context.Background(), reader, appInfo)
+}
+
+func (wac *Conn) upload(ctx context.Context, reader io.Reader, appInfo MediaType) (url string, mediaKey []byte, fileEncSha256 []byte, fileSha256 []byte, fileLength uint64, err error) {
+	if rs, ok := reader.(io.ReadSeeker); ok && wac.StreamingUpload {
+		return wac.uploadStreaming(ctx, rs, appInfo)
+	}
+
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return "", nil, nil, nil, 0, err
@@ -120,6 +557,121 @@ func (wac *Conn) Upload(reader io.Reader, appInfo MediaType) (url string, mediaK
 	sha.Write(append(enc, mac...))
 	fileEncSha256 = sha.Sum(nil)
 
+	file := append(enc, mac...)
+	open := func() (io.Reader, func()) {
+		return bytes.NewReader(file), func() {}
+	}
+	url, err = wac.uploadMedia(ctx, appInfo, fileEncSha256, open, int64(len(file)))
+	if err != nil {
+		return "", nil, nil, nil, 0, err
+	}
+
+	return url, mediaKey, fileEncSha256, fileSha256, fileLength, nil
+}
+
+/*
+uploadStreaming uploads the content of reader without holding it in memory. The upload url has to be requested with
+the hash of the encrypted file, so the content is read and encrypted twice: once to compute the hashes and once while
+it is uploaded.
+*/
+func (wac *Conn) uploadStreaming(ctx context.Context, reader io.ReadSeeker, appInfo MediaType) (url string, mediaKey []byte, fileEncSha256 []byte, fileSha256 []byte, fileLength uint64, err error) {
+	mediaKey = make([]byte, 32)
+	rand.Read(mediaKey)
+
+	iv, cipherKey, macKey, _, err := getMediaKeys(mediaKey, appInfo)
+	if err != nil {
+		return "", nil, nil, nil, 0, err
+	}
+
+	start, err := reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", nil, nil, nil, 0, err
+	}
+	fileSha256, fileEncSha256, fileLength, err = encryptMedia(reader, ioutil.Discard, iv, cipherKey, macKey)
+	if err != nil {
+		return "", nil, nil, nil, 0, err
+	}
+
+	// every upload attempt encrypts the content again
+	open := func() (io.Reader, func()) {
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if _, err := reader.Seek(start, io.SeekStart); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, uploaded, _, err := encryptMedia(reader, pw, iv, cipherKey, macKey)
+			if err == nil && !bytes.Equal(uploaded, fileEncSha256) {
+				err = fmt.Errorf("content changed during upload")
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, func() {
+			pr.Close()
+			<-done
+		}
+	}
+
+	url, err = wac.uploadMedia(ctx, appInfo, fileEncSha256, open, encryptedMediaSize(int(fileLength)))
+	if err != nil {
+		return "", nil, nil, nil, 0, err
+	}
+
+	return url, mediaKey, fileEncSha256, fileSha256, fileLength, nil
+}
+
+// encryptMedia encrypts the content of r like cbc.Encrypt and writes the encrypted file, followed by its mac, to w.
+func encryptMedia(r io.Reader, w io.Writer, iv, cipherKey, macKey []byte) (fileSha256 []byte, fileEncSha256 []byte, fileLength uint64, err error) {
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	encrypter := cipher.NewCBCEncrypter(block, iv)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	sha, encSha := sha256.New(), sha256.New()
+	out := io.MultiWriter(w, mac, encSha)
+
+	buf := make([]byte, 32*1024, 32*1024+aes.BlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, nil, 0, err
+		}
+		sha.Write(buf[:n])
+		fileLength += uint64(n)
+
+		chunk := buf[:n]
+		if err != nil {
+			// last chunk, pkcs7 padding like cbc.Encrypt
+			padding := aes.BlockSize - n%aes.BlockSize
+			chunk = append(chunk, bytes.Repeat([]byte{byte(padding)}, padding)...)
+		}
+		encrypter.CryptBlocks(chunk, chunk)
+		if _, werr := out.Write(chunk); werr != nil {
+			return nil, nil, 0, werr
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	sum := mac.Sum(nil)[:10]
+	if _, err := w.Write(sum); err != nil {
+		return nil, nil, 0, err
+	}
+	encSha.Write(sum)
+
+	return sha.Sum(nil), encSha.Sum(nil), fileLength, nil
+}
+
+// uploadMedia requests an upload url for the encrypted file with hash fileEncSha256 and uploads size bytes of the file
+// to it. open returns a reader for the file and a function to release it, it is called once per upload attempt. It
+// returns the url of the uploaded media.
+func (wac *Conn) uploadMedia(ctx context.Context, appInfo MediaType, fileEncSha256 []byte, open func() (io.Reader, func()), size int64) (string, error) {
 	var filetype string
 	switch appInfo {
 	case MediaImage:
@@ -135,65 +687,109 @@ func (wac *Conn) Upload(reader io.Reader, appInfo MediaType) (url string, mediaK
 	uploadReq := []interface{}{"action", "encr_upload", filetype, base64.StdEncoding.EncodeToString(fileEncSha256)}
 	ch, err := wac.write(uploadReq)
 	if err != nil {
-		return "", nil, nil, nil, 0, err
+		return "", err
 	}
 
 	var resp map[string]interface{}
 	select {
 	case r := <-ch:
 		if err = json.Unmarshal([]byte(r), &resp); err != nil {
-			return "", nil, nil, nil, 0, fmt.Errorf("error decoding upload response: %v\n", err)
+			return "", fmt.Errorf("error decoding upload response: %v\n", err)
 		}
+	case <-ctx.Done():
+		return "", ctx.Err()
 	case <-time.After(wac.msgTimeout):
-		return "", nil, nil, nil, 0, fmt.Errorf("restore session init timed out")
+		return "", fmt.Errorf("restore session init timed out")
 	}
 
 	if int(resp["status"].(float64)) != 200 {
-		return "", nil, nil, nil, 0, fmt.Errorf("upload responsed with %d", resp["status"])
+		return "", fmt.Errorf("upload responsed with %d", resp["status"])
 	}
 
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+	return wac.postMediaWithRetries(ctx, resp["url"].(string), fileEncSha256, open, size)
+}
+
+// mediaUploadRetryDelay is the delay before the first retry of a failed upload, it doubles with every retry.
+var mediaUploadRetryDelay = time.Second
+
+// postMediaWithRetries posts the file to the upload url, retrying network errors and server errors up to
+// MediaUploadRetries times with exponential backoff.
+func (wac *Conn) postMediaWithRetries(ctx context.Context, url string, fileEncSha256 []byte, open func() (io.Reader, func()), size int64) (string, error) {
+	for attempt := 0; ; attempt++ {
+		file, release := open()
+		mediaUrl, retry, err := wac.postMedia(ctx, url, fileEncSha256, file, size)
+		release()
+		if err == nil {
+			return mediaUrl, nil
+		}
+		if !retry || attempt >= wac.MediaUploadRetries {
+			return "", err
+		}
+
+		// up to 50% jitter, so failed uploads of several clients are not retried at the same time
+		var jitter [1]byte
+		rand.Read(jitter[:])
+		delay := mediaUploadRetryDelay << uint(attempt)
+		delay += delay * time.Duration(jitter[0]) / 512
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// postMedia posts size bytes of file to the upload url and returns the url of the uploaded media. On failure, it
+// reports whether the upload can be retried, which is the case for network errors and server errors.
+func (wac *Conn) postMedia(ctx context.Context, url string, fileEncSha256 []byte, file io.Reader, size int64) (string, bool, error) {
+	// the multipart header and trailer are written to buffers, so the file can be streamed in between
+	var header, trailer bytes.Buffer
+	w := multipart.NewWriter(&header)
 	hashWriter, err := w.CreateFormField("hash")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 	io.Copy(hashWriter, strings.NewReader(base64.StdEncoding.EncodeToString(fileEncSha256)))
 
-	fileWriter, err := w.CreateFormFile("file", "blob")
-	if err != nil {
+	if _, err = w.CreateFormFile("file", "blob"); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
-	io.Copy(fileWriter, bytes.NewReader(append(enc, mac...)))
+	contentType := w.FormDataContentType()
+	w = multipart.NewWriter(&trailer)
+	w.SetBoundary(strings.TrimPrefix(contentType, "multipart/form-data; boundary="))
 	err = w.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 
-	req, err := http.NewRequest("POST", resp["url"].(string), &b)
+	body := io.MultiReader(&header, io.LimitReader(file, size), &trailer)
+	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
-		return "", nil, nil, nil, 0, err
+		return "", false, err
 	}
+	req = req.WithContext(ctx)
+	req.ContentLength = int64(header.Len()) + size + int64(trailer.Len())
 
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Origin", "https://web.whatsapp.com")
 	req.Header.Set("Referer", "https://web.whatsapp.com/")
 
 	req.URL.Query().Set("f", "j")
 
-	client := &http.Client{}
 	// Submit the request
-	res, err := client.Do(req)
+	res, err := wac.mediaClient().Do(req)
 	if err != nil {
-		return "", nil, nil, nil, 0, err
+		return "", ctx.Err() == nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return "", nil, nil, nil, 0, fmt.Errorf("upload failed with status code %d", res.StatusCode)
+		return "", res.StatusCode >= 500, fmt.Errorf("upload failed with status code %d", res.StatusCode)
 	}
 
 	var jsonRes map[string]string
 	json.NewDecoder(res.Body).Decode(&jsonRes)
 
-	return jsonRes["url"], mediaKey, fileEncSha256, fileSha256, fileLength, nil
+	return jsonRes["url"], false, nil
 }
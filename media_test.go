@@ -0,0 +1,366 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"github.com/Rhymen/go-whatsapp/crypto/cbc"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// encryptTestMedia encrypts data like Upload does and returns the media key and the encrypted file as it is stored
+// on the WhatsApp servers.
+func encryptTestMedia(t *testing.T, data []byte, appInfo MediaType) (mediaKey []byte, file []byte) {
+	mediaKey = make([]byte, 32)
+	rand.Read(mediaKey)
+
+	iv, cipherKey, macKey, _, err := getMediaKeys(mediaKey, appInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := cbc.Encrypt(cipherKey, iv, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(append(iv, enc...))
+	return mediaKey, append(enc, h.Sum(nil)[:10]...)
+}
+
+// serveTestMedia serves file on every request until the test ends.
+func serveTestMedia(t *testing.T, file []byte) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(file)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDownloadQuotedImage(t *testing.T) {
+	data := []byte("quoted image content")
+	mediaKey, file := encryptTestMedia(t, data, MediaImage)
+	url := serveTestMedia(t, file)
+	fileLength := uint64(len(data))
+
+	remoteJid, id, quotedId, text := "491234567890@s.whatsapp.net", "ID", "QUOTED", "reply"
+	msg := parseProtoMessage(&proto.WebMessageInfo{
+		Key: &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		Message: &proto.Message{
+			ExtendedTextMessage: &proto.ExtendedTextMessage{
+				Text: &text,
+				ContextInfo: &proto.ContextInfo{
+					StanzaId:    &quotedId,
+					Participant: &remoteJid,
+					QuotedMessage: []*proto.Message{{
+						ImageMessage: &proto.ImageMessage{
+							Url:        &url,
+							MediaKey:   mediaKey,
+							FileLength: &fileLength,
+						},
+					}},
+				},
+			},
+		},
+	})
+
+	reply, ok := msg.(TextMessage)
+	if !ok {
+		t.Fatalf("parsed as %T", msg)
+	}
+	if reply.Info.QuotedMessageID != quotedId {
+		t.Errorf("unexpected quoted message id %q", reply.Info.QuotedMessageID)
+	}
+	quoted, ok := reply.Info.QuotedMessage.(ImageMessage)
+	if !ok {
+		t.Fatalf("quoted message parsed as %T", reply.Info.QuotedMessage)
+	}
+	if quoted.Info.Id != quotedId || quoted.Info.RemoteJid != remoteJid {
+		t.Errorf("unexpected quoted message info %+v", quoted.Info)
+	}
+
+	content, err := quoted.Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(data) {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestDownloadOversizedMedia(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	mediaKey, file := encryptTestMedia(t, data, MediaImage)
+
+	// the file length of the message claims less than the server sends
+	url := serveTestMedia(t, file)
+	if _, err := Download(url, mediaKey, MediaImage, 100); err != ErrMediaSizeMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// streamed without content length, so the limit has to be enforced while reading
+	url = serveTestMedia(t, append(file, make([]byte, 1<<20)...))
+	if _, err := Download(url, mediaKey, MediaImage, len(data)); err != ErrMediaSizeMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	url = serveTestMedia(t, file)
+	if content, err := Download(url, mediaKey, MediaImage, len(data)); err != nil || !bytes.Equal(content, data) {
+		t.Errorf("unexpected download result %v", err)
+	}
+}
+
+func TestDownloadMaxMediaSize(t *testing.T) {
+	defer func(size int64) { DefaultMaxMediaSize = size }(DefaultMaxMediaSize)
+	DefaultMaxMediaSize = 100
+
+	requests := 0
+	data := bytes.Repeat([]byte("x"), 1000)
+	mediaKey, file := encryptTestMedia(t, data, MediaImage)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(file)
+	}))
+	defer server.Close()
+
+	// a message claiming a huge file is rejected without a request
+	msg := ImageMessage{url: server.URL, mediaKey: mediaKey, fileLength: 10 << 30}
+	if _, err := msg.Download(); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge, got %v", err)
+	}
+	msg.fileLength = uint64(len(data))
+	if _, err := msg.Download(); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge, got %v", err)
+	}
+	if _, err := msg.DownloadToWriter(ioutil.Discard); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge from DownloadToWriter, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("%d requests for media larger than DefaultMaxMediaSize", requests)
+	}
+
+	sha := sha256.Sum256(file)
+	if _, err := DownloadEncrypted(server.URL, sha[:]); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge from DownloadEncrypted, got %v", err)
+	}
+
+	DefaultMaxMediaSize = int64(len(data))
+	if content, err := msg.Download(); err != nil || !bytes.Equal(content, data) {
+		t.Errorf("download of media within the limit failed: %v", err)
+	}
+	if _, err := DownloadEncrypted(server.URL, sha[:]); err != nil {
+		t.Errorf("encrypted download of media within the limit failed: %v", err)
+	}
+}
+
+func TestEncryptMedia(t *testing.T) {
+	for _, n := range []int{0, 15, 16, 32 * 1024, 100000} {
+		data := make([]byte, n)
+		rand.Read(data)
+		mediaKey, file := encryptTestMedia(t, data, MediaVideo)
+		iv, cipherKey, macKey, _, _ := getMediaKeys(mediaKey, MediaVideo)
+
+		var b bytes.Buffer
+		fileSha256, fileEncSha256, fileLength, err := encryptMedia(bytes.NewReader(data), &b, iv, cipherKey, macKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), file) {
+			t.Errorf("streamed encryption of %d bytes differs", n)
+		}
+		if sha := sha256.Sum256(data); !bytes.Equal(fileSha256, sha[:]) || fileLength != uint64(n) {
+			t.Errorf("invalid file hash or length for %d bytes", n)
+		}
+		if sha := sha256.Sum256(file); !bytes.Equal(fileEncSha256, sha[:]) {
+			t.Errorf("invalid encrypted file hash for %d bytes", n)
+		}
+		if int64(len(file)) != encryptedMediaSize(n) {
+			t.Errorf("encrypted size of %d bytes is %d", n, len(file))
+		}
+	}
+}
+
+func TestMediaAvailable(t *testing.T) {
+	msg := ImageMessage{url: serveTestMedia(t, []byte("file"))}
+	if ok, err := msg.MediaAvailable(); !ok || err != nil {
+		t.Errorf("available media reported as %v, %v", ok, err)
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	msg = ImageMessage{url: server.URL, mediaKey: make([]byte, 32)}
+	if ok, err := msg.MediaAvailable(); ok || err != ErrMediaExpired {
+		t.Errorf("expired media reported as %v, %v", ok, err)
+	}
+	if _, err := msg.Download(); err != ErrMediaExpired {
+		t.Errorf("unexpected download error %v", err)
+	}
+}
+
+func TestDownloadToWriter(t *testing.T) {
+	for _, size := range []int{0, 15, 16, 100000} {
+		data := make([]byte, size)
+		rand.Read(data)
+		mediaKey, file := encryptTestMedia(t, data, MediaVideo)
+
+		var b bytes.Buffer
+		n, err := DownloadToWriter(&b, serveTestMedia(t, file), mediaKey, MediaVideo, size)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if n != int64(size) || !bytes.Equal(b.Bytes(), data) {
+			t.Errorf("size %d: downloaded data does not match", size)
+		}
+
+		file[len(file)-1] ^= 1
+		if _, err := DownloadToWriter(ioutil.Discard, serveTestMedia(t, file), mediaKey, MediaVideo, size); err != ErrMediaHashMismatch {
+			t.Errorf("size %d: unexpected error for invalid mac: %v", size, err)
+		}
+		if _, err := Download(serveTestMedia(t, file), mediaKey, MediaVideo, size); err != ErrMediaHashMismatch {
+			t.Errorf("size %d: unexpected error for invalid mac: %v", size, err)
+		}
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDownloadMediaClient(t *testing.T) {
+	data := []byte("image content")
+	mediaKey, file := encryptTestMedia(t, data, MediaImage)
+	msg := ImageMessage{url: serveTestMedia(t, file), mediaKey: mediaKey, fileLength: uint64(len(data))}
+
+	transport := &countingTransport{}
+	wac := &Conn{MediaClient: &http.Client{Transport: transport}}
+	downloaded, err := wac.DownloadMedia(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Error("downloaded data does not match")
+	}
+	if transport.requests != 1 {
+		t.Errorf("media client made %d requests, expected 1", transport.requests)
+	}
+
+	var buf bytes.Buffer
+	if _, err := wac.DownloadMediaToWriter(&buf, &msg); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("streamed download failed: %v", err)
+	}
+	sha := sha256.Sum256(file)
+	msg.fileEncSha256 = sha[:]
+	if encrypted, err := wac.DownloadEncryptedMedia(msg); err != nil || !bytes.Equal(encrypted, file) {
+		t.Errorf("encrypted download failed: %v", err)
+	}
+	if ok, err := wac.MediaAvailable(msg); !ok || err != nil {
+		t.Errorf("media not available: %v", err)
+	}
+	if transport.requests != 4 {
+		t.Errorf("media client made %d requests, expected 4", transport.requests)
+	}
+
+	if _, err := wac.DownloadMedia(TextMessage{}); err == nil {
+		t.Error("no error for text message")
+	}
+
+	wac.MaxMediaSize = int64(len(data)) - 1
+	if _, err := wac.DownloadMedia(msg); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge, got %v", err)
+	}
+	if transport.requests != 4 {
+		t.Errorf("media larger than MaxMediaSize was requested")
+	}
+
+	msg.fileLength = 1 << 63
+	wac.MaxMediaSize = 0
+	if _, err := wac.DownloadMedia(msg); err != ErrMediaTooLarge {
+		t.Errorf("expected ErrMediaTooLarge for overflowing file length, got %v", err)
+	}
+}
+
+func TestDetectMimetype(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 1000)...)
+
+	mimetype, r, err := detectMimetype(bytes.NewReader(png))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.(io.ReadSeeker); !ok || mimetype != "image/png" {
+		t.Errorf("unexpected mimetype %q or reader %T", mimetype, r)
+	}
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, png) {
+		t.Error("content of seekable reader changed")
+	}
+
+	mimetype, r, err = detectMimetype(io.MultiReader(bytes.NewReader(png)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); mimetype != "image/png" || !bytes.Equal(data, png) {
+		t.Errorf("unexpected mimetype %q or content", mimetype)
+	}
+}
+
+func TestUploadRetries(t *testing.T) {
+	defer func(delay time.Duration) { mediaUploadRetryDelay = delay }(mediaUploadRetryDelay)
+	mediaUploadRetryDelay = time.Millisecond
+
+	file := []byte("encrypted media")
+	open := func() (io.Reader, func()) {
+		return bytes.NewReader(file), func() {}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+		ok       bool
+	}{
+		{"server error retried", []int{500, 503, 200}, 2, 3, true},
+		{"retries exhausted", []int{500, 500, 500}, 1, 2, false},
+		{"client error not retried", []int{400, 200}, 2, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[requests]
+				requests++
+				body, _ := ioutil.ReadAll(r.Body)
+				if !bytes.Contains(body, file) {
+					t.Error("upload does not contain the file")
+				}
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]string{"url": "https://mmg.whatsapp.net/test"})
+			}))
+			defer server.Close()
+
+			wac := &Conn{MediaUploadRetries: tc.retries}
+			url, err := wac.postMediaWithRetries(context.Background(), server.URL, []byte("hash"), open, int64(len(file)))
+			if tc.ok && (err != nil || url != "https://mmg.whatsapp.net/test") {
+				t.Errorf("upload failed: %q, %v", url, err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("upload succeeded, expected an error")
+			}
+			if requests != tc.requests {
+				t.Errorf("made %d requests, expected %d", requests, tc.requests)
+			}
+		})
+	}
+}
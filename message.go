@@ -1,16 +1,21 @@
 package whatsapp
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/Rhymen/go-whatsapp/binary"
 	"github.com/Rhymen/go-whatsapp/binary/proto"
+	pb "github.com/golang/protobuf/proto"
 	"io"
-	"math/rand"
+	"math"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 type MediaType string
@@ -23,63 +28,406 @@ const (
 )
 
 func (wac *Conn) Send(msg interface{}) error {
-	var err error
-	var ch <-chan string
+	_, err := wac.SendAndWaitAck(msg)
+	return err
+}
 
-	switch m := msg.(type) {
-	case *proto.WebMessageInfo:
-		ch, err = wac.sendProto(m)
-	case TextMessage:
-		ch, err = wac.sendProto(getTextProto(m))
-	case ImageMessage:
-		m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.Upload(m.Content, MediaImage)
+/*
+SendAndWaitAck sends msg like Send and returns the decoded response of the server, which e.g. contains the timestamp
+"t" the server assigned to the message.
+*/
+func (wac *Conn) SendAndWaitAck(msg interface{}) (map[string]interface{}, error) {
+	_, resp, err := wac.sendAndWait(context.Background(), msg)
+	return resp, err
+}
+
+/*
+SendWithContext sends msg like Send and returns the id of the sent message. The context bounds the upload of media and
+the wait for the response of the server, if it is done before, ctx.Err() is returned. If ctx has a deadline, it replaces
+the timeout of the connection for the response, which allows to give large media uploads more time than other messages.
+*/
+func (wac *Conn) SendWithContext(ctx context.Context, msg interface{}) (string, error) {
+	return wac.send(ctx, msg)
+}
+
+/*
+SendBatch sends msgs one after another and returns the ids of the sent messages in order. Every message waits for the
+server response of the previous one, so the messages arrive in the given order. Sending stops at the first error, the
+ids of the messages sent before are returned together with a *BatchError.
+*/
+func (wac *Conn) SendBatch(msgs []interface{}) ([]string, error) {
+	ids := make([]string, 0, len(msgs))
+	for i, msg := range msgs {
+		id, err := wac.send(context.Background(), msg)
 		if err != nil {
-			return fmt.Errorf("image upload failed: %v", err)
+			return ids, &BatchError{Index: i, Total: len(msgs), Err: err}
 		}
-		ch, err = wac.sendProto(getImageProto(m))
-	case VideoMessage:
-		m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.Upload(m.Content, MediaVideo)
-		if err != nil {
-			return fmt.Errorf("video upload failed: %v", err)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+/*
+BatchError is returned by SendBatch if a message of the batch could not be sent. Index is the position of the message
+in the batch and Err the error of sending it, e.g. a *SendError or ErrSendTimeout, which errors.Is and errors.As find
+through Unwrap.
+*/
+type BatchError struct {
+	Index int
+	Total int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("sending message %d of %d failed: %v", e.Index+1, e.Total, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+/*
+SendError is returned by Send if the server rejected a message. Code is the status the server responded with,
+MessageID the id of the rejected message and Raw the complete response.
+*/
+type SendError struct {
+	Code      int
+	MessageID string
+	Raw       map[string]interface{}
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("message sending responded with %d", e.Code)
+}
+
+// send sends msg and returns the id of the sent message.
+func (wac *Conn) send(ctx context.Context, msg interface{}) (string, error) {
+	id, _, err := wac.sendAndWait(ctx, msg)
+	return id, err
+}
+
+// sendAndWait sends msg and returns the id of the sent message together with the decoded response of the server.
+func (wac *Conn) sendAndWait(ctx context.Context, msg interface{}) (string, map[string]interface{}, error) {
+	var err error
+
+	if !wac.IsLoggedIn() {
+		return "", nil, ErrNotConnected
+	}
+
+	release, err := wac.acquireInFlightSend(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+
+	if msg, err = wac.applySendMiddleware(msg); err != nil {
+		return "", nil, err
+	}
+
+	if IsNewsletterJID(getRemoteJid(msg)) {
+		return "", nil, fmt.Errorf("sending to channels is not supported")
+	}
+
+	// unsupported types are rejected by buildProto
+	switch msg.(type) {
+	case *proto.WebMessageInfo, MessageInfoGetter:
+		if err = ValidateJID(getRemoteJid(msg)); err != nil {
+			return "", nil, err
 		}
-		ch, err = wac.sendProto(getVideoProto(m))
-	case DocumentMessage:
-		m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.Upload(m.Content, MediaDocument)
+	}
+
+	if wac.isOrderedSends() {
+		release, err := wac.enqueueSend(ctx, getRemoteJid(msg))
 		if err != nil {
-			return fmt.Errorf("document upload failed: %v", err)
+			return "", nil, err
 		}
-		ch, err = wac.sendProto(getDocumentProto(m))
-	case AudioMessage:
-		m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.Upload(m.Content, MediaAudio)
-		if err != nil {
-			return fmt.Errorf("audio upload failed: %v", err)
+		defer release()
+	}
+
+	// the typing indicator is cleared right after the message is written, or when the send fails before
+	var typingJid string
+	if text, ok := msg.(TextMessage); ok && wac.AutoPresence {
+		typingJid = text.Info.RemoteJid
+		defer func() {
+			if typingJid != "" {
+				wac.pauseTyping(typingJid)
+			}
+		}()
+		if err = wac.simulateTyping(ctx, text); err != nil {
+			return "", nil, err
 		}
-		ch, err = wac.sendProto(getAudioProto(m))
-	default:
-		return fmt.Errorf("cannot match type %T, use message types declared in the package", msg)
 	}
 
+	p, err := wac.buildProto(ctx, msg, true)
 	if err != nil {
-		return fmt.Errorf("could not send proto: %v", err)
+		return "", nil, err
+	}
+
+	if err = wac.addToOutbox(p); err != nil {
+		return "", nil, err
+	}
+
+	ch, err := wac.sendProto(p)
+	if typingJid != "" {
+		wac.pauseTyping(typingJid)
+		typingJid = ""
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("could not send proto: %v", err)
+	}
+
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timeout = time.After(wac.msgTimeout)
 	}
 
 	select {
 	case response := <-ch:
-		var resp map[string]interface{}
-		if err = json.Unmarshal([]byte(response), &resp); err != nil {
-			return fmt.Errorf("error decoding sending response: %v\n", err)
+		resp, err := wac.handleSendResponse(p, response)
+		if err != nil {
+			return "", nil, err
+		}
+		return p.Key.GetId(), resp, nil
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	case <-timeout:
+		return "", nil, ErrSendTimeout
+	}
+}
+
+// handleSendResponse decodes the response of the server to the sent message p. Delivered messages are removed from the
+// outbox and added to the store. Messages the server rejected are removed from the outbox as well, sending them again
+// would fail again.
+func (wac *Conn) handleSendResponse(p *proto.WebMessageInfo, response string) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal([]byte(response), &resp); err != nil {
+		return nil, fmt.Errorf("error decoding sending response: %v\n", err)
+	}
+	if status, _ := resp["status"].(float64); int(status) != 200 {
+		wac.removeFromOutbox(p)
+		return nil, &SendError{Code: int(status), MessageID: p.Key.GetId(), Raw: resp}
+	}
+
+	wac.removeFromOutbox(p)
+	wac.Store.addMessage(p)
+	return resp, nil
+}
+
+// simulateTyping shows the typing indicator in the chat of msg and waits a time proportional to the text length. It
+// returns the error of ctx if ctx is done before. Presence errors are passed to the handlers, the message is sent
+// without typing indicator then.
+func (wac *Conn) simulateTyping(ctx context.Context, msg TextMessage) error {
+	if _, err := wac.Presence(msg.Info.RemoteJid, PresenceComposing); err != nil {
+		wac.handle(fmt.Errorf("error sending composing presence: %v", err))
+		return nil
+	}
+
+	delay := time.Duration(utf8.RuneCountInString(msg.Text)) * wac.AutoPresenceDelay
+	if delay > wac.AutoPresenceMaxDelay {
+		delay = wac.AutoPresenceMaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseTyping clears the typing indicator shown by simulateTyping in the chat jid. Presence errors are passed to the
+// handlers.
+func (wac *Conn) pauseTyping(jid string) {
+	if _, err := wac.Presence(jid, PresencePaused); err != nil {
+		wac.handle(fmt.Errorf("error sending paused presence: %v", err))
+	}
+}
+
+/*
+BuildProto returns the proto Send would send for msg without sending it, e.g. to inspect or log outgoing messages. It
+runs the same steps as Send, including the generation of the message id and timestamp, but does not upload media:
+the media fields (url, media key, hashes and file length) of media messages are left empty. A proto can be sent later
+on with SendRaw, for media messages this requires to fill in the media fields of an upload first.
+*/
+func (wac *Conn) BuildProto(msg interface{}) (*proto.WebMessageInfo, error) {
+	return wac.buildProto(context.Background(), msg, false)
+}
+
+/*
+SendRaw sends a proto as it is, e.g. one built with BuildProto or a message type the package does not support, and
+returns the id of the sent message. Like for the other message types, a missing id and timestamp are generated. It is
+the same as calling Send with the proto.
+*/
+func (wac *Conn) SendRaw(p *proto.WebMessageInfo) (string, error) {
+	return wac.send(context.Background(), p)
+}
+
+/*
+SendText sends text to jid and returns the id of the sent message, which is the id receipts and replies refer to.
+Send can be used with a preset Info.Id for the same purpose.
+*/
+func (wac *Conn) SendText(jid, text string) (string, error) {
+	return wac.send(context.Background(), TextMessage{Info: MessageInfo{RemoteJid: jid}, Text: text})
+}
+
+// buildProto returns the proto that is sent for msg. The content of media messages is only uploaded if upload is set.
+func (wac *Conn) buildProto(ctx context.Context, msg interface{}, upload bool) (*proto.WebMessageInfo, error) {
+	var err error
+
+	switch m := msg.(type) {
+	case *proto.WebMessageInfo:
+		if err = wac.setRawMessageInfo(ctx, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case TextMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		return getTextProto(m), nil
+	case ImageMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		if m.Type == "" && m.Content != nil {
+			if m.Type, m.Content, err = detectMimetype(m.Content); err != nil {
+				return nil, fmt.Errorf("image mimetype detection failed: %v", err)
+			}
+		}
+		if wac.MaxImageDimension > 0 {
+			if err = resizeImageMessage(&m, wac.MaxImageDimension); err != nil {
+				return nil, fmt.Errorf("image resize failed: %v", err)
+			}
+		}
+		if err = generateImageThumbnail(&m); err != nil {
+			return nil, fmt.Errorf("image thumbnail failed: %v", err)
+		}
+		if wac.BlurThumbnails {
+			if err = blurImageThumbnail(&m); err != nil {
+				return nil, fmt.Errorf("image thumbnail failed: %v", err)
+			}
+		}
+		if upload {
+			m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.upload(ctx, m.Content, MediaImage)
+			if err != nil {
+				return nil, fmt.Errorf("image upload failed: %v", err)
+			}
+		}
+		return getImageProto(m), nil
+	case VideoMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		if m.Type == "" && m.Content != nil {
+			if m.Type, m.Content, err = detectMimetype(m.Content); err != nil {
+				return nil, fmt.Errorf("video mimetype detection failed: %v", err)
+			}
+		}
+		if wac.BlurThumbnails && m.Thumbnail != nil {
+			if m.Thumbnail, err = blurThumbnail(m.Thumbnail); err != nil {
+				return nil, fmt.Errorf("video thumbnail failed: %v", err)
+			}
+		}
+		if upload {
+			m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.upload(ctx, m.Content, MediaVideo)
+			if err != nil {
+				return nil, fmt.Errorf("video upload failed: %v", err)
+			}
+		}
+		return getVideoProto(m), nil
+	case DocumentMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		if m.Type == "" && m.Content != nil {
+			if m.Type, m.Content, err = detectMimetype(m.Content); err != nil {
+				return nil, fmt.Errorf("document mimetype detection failed: %v", err)
+			}
+		}
+		if err = wac.generateDocumentThumbnail(&m); err != nil {
+			return nil, fmt.Errorf("document thumbnail failed: %v", err)
+		}
+		if upload {
+			m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.upload(ctx, m.Content, MediaDocument)
+			if err != nil {
+				return nil, fmt.Errorf("document upload failed: %v", err)
+			}
+		}
+		return getDocumentProto(m), nil
+	case AudioMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		if m.Type == "" && m.Content != nil {
+			if m.Type, m.Content, err = detectMimetype(m.Content); err != nil {
+				return nil, fmt.Errorf("audio mimetype detection failed: %v", err)
+			}
+		}
+		if upload {
+			m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.upload(ctx, m.Content, MediaAudio)
+			if err != nil {
+				return nil, fmt.Errorf("audio upload failed: %v", err)
+			}
+		}
+		return getAudioProto(m), nil
+	case StickerMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		if err = validateSticker(&m); err != nil {
+			return nil, err
+		}
+		if upload {
+			m.url, m.mediaKey, m.fileEncSha256, m.fileSha256, m.fileLength, err = wac.upload(ctx, m.Content, MediaImage)
+			if err != nil {
+				return nil, fmt.Errorf("sticker upload failed: %v", err)
+			}
+		}
+		return getStickerProto(m), nil
+	case TemplateMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
 		}
-		if int(resp["status"].(float64)) != 200 {
-			return fmt.Errorf("message sending responded with %d", resp["status"])
+		return getTemplateProto(m), nil
+	case ContactMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
 		}
-	case <-time.After(wac.msgTimeout):
-		return fmt.Errorf("sending message timed out")
+		return getContactProto(m), nil
+	case ContactsArrayMessage:
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		return getContactsArrayProto(m), nil
+	case LocationMessage:
+		if err = validateCoordinates(m.DegreesLatitude, m.DegreesLongitude); err != nil {
+			return nil, err
+		}
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		return getLocationProto(m), nil
+	case LiveLocationMessage:
+		if err = validateCoordinates(m.DegreesLatitude, m.DegreesLongitude); err != nil {
+			return nil, err
+		}
+		if err = wac.setMessageInfo(ctx, &m.Info); err != nil {
+			return nil, err
+		}
+		return getLiveLocationProto(m), nil
 	}
 
-	return nil
+	return nil, fmt.Errorf("cannot match type %T, use message types declared in the package", msg)
 }
 
 func (wac *Conn) sendProto(p *proto.WebMessageInfo) (<-chan string, error) {
+	if wac.DeviceJid != "" && p.Key.GetParticipant() == "" {
+		participant := wac.DeviceJid
+		p.Key.Participant = &participant
+	}
+
 	n := binary.Node{
 		Description: "action",
 		Attributes: map[string]string{
@@ -91,26 +439,260 @@ func (wac *Conn) sendProto(p *proto.WebMessageInfo) (<-chan string, error) {
 	return wac.writeBinary(n, message, ignore, p.Key.GetId())
 }
 
-func init() {
-	rand.Seed(time.Now().UTC().UnixNano())
+/*
+SendMiddleware is called by Send before the message is processed. It returns the message that should be sent instead,
+which may be the unchanged msg, a modified copy or a message of another type. Returning an error aborts the send, the
+error is returned by Send.
+*/
+type SendMiddleware func(msg interface{}) (interface{}, error)
+
+/*
+AddSendMiddleware adds a middleware that is run on every message passed to Send. Middlewares run in the order they were
+added, each one receives the message returned by the previous one. The message types of this package are values, a
+middleware that wants to change a message has to return the changed copy. Middlewares run before any upload or proto
+construction, so they may also replace media content.
+*/
+func (wac *Conn) AddSendMiddleware(middleware SendMiddleware) {
+	wac.middlewareMutex.Lock()
+	wac.sendMiddleware = append(wac.sendMiddleware, middleware)
+	wac.middlewareMutex.Unlock()
+}
+
+func (wac *Conn) applySendMiddleware(msg interface{}) (interface{}, error) {
+	wac.middlewareMutex.RLock()
+	middleware := wac.sendMiddleware
+	wac.middlewareMutex.RUnlock()
+
+	for _, m := range middleware {
+		var err error
+		if msg, err = m(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+/*
+SetMaxInFlightSends limits the number of Send calls that are processed at the same time to n. A send is in flight from
+the start of Send, including media uploads, until the server responded. If the limit is reached, further sends block
+until a slot is free, or fail with ErrTooManyInFlightSends if failFast is set. This bounds the memory held by pending
+media sends. A limit of zero or less removes the limit, which is the default.
+*/
+func (wac *Conn) SetMaxInFlightSends(n int, failFast bool) {
+	var sem chan struct{}
+	if n > 0 {
+		sem = make(chan struct{}, n)
+	}
+
+	wac.inFlightMutex.Lock()
+	wac.inFlightSem = sem
+	wac.inFlightFast = failFast
+	wac.inFlightMutex.Unlock()
+}
+
+/*
+InFlightSends returns the number of Send calls that are currently processed.
+*/
+func (wac *Conn) InFlightSends() int {
+	return int(atomic.LoadInt32(&wac.inFlightSends))
+}
+
+// acquireInFlightSend counts a send as in flight. If the limit set with SetMaxInFlightSends is reached it waits for a
+// free slot or until ctx is done.
+func (wac *Conn) acquireInFlightSend(ctx context.Context) (release func(), err error) {
+	wac.inFlightMutex.Lock()
+	sem, failFast := wac.inFlightSem, wac.inFlightFast
+	wac.inFlightMutex.Unlock()
+
+	if sem != nil {
+		if failFast {
+			select {
+			case sem <- struct{}{}:
+			default:
+				return nil, ErrTooManyInFlightSends
+			}
+		} else {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	atomic.AddInt32(&wac.inFlightSends, 1)
+	return func() {
+		atomic.AddInt32(&wac.inFlightSends, -1)
+		if sem != nil {
+			<-sem
+		}
+	}, nil
+}
+
+/*
+SetOrderedSends enables or disables ordered sending. When enabled, Send calls for the same RemoteJid are processed
+strictly in the order they were made: a message is only written after the previous message to that chat got its
+response from the server. The c.us and s.whatsapp.net addresses of a user are the same chat. Messages to different
+chats are still sent in parallel. Ordered sending is disabled by default.
+*/
+func (wac *Conn) SetOrderedSends(ordered bool) {
+	wac.sendQueueMutex.Lock()
+	wac.orderedSends = ordered
+	wac.sendQueueMutex.Unlock()
+}
+
+func (wac *Conn) isOrderedSends() bool {
+	wac.sendQueueMutex.Lock()
+	defer wac.sendQueueMutex.Unlock()
+	return wac.orderedSends
+}
+
+// enqueueSend blocks until all earlier sends to jid are done or ctx is done. The returned function has to be called
+// once the send is finished to let the next one proceed. The legacy and the current address of a user share a queue.
+func (wac *Conn) enqueueSend(ctx context.Context, jid string) (release func(), err error) {
+	jid = normalizeJid(jid)
+	done := make(chan struct{})
+
+	wac.sendQueueMutex.Lock()
+	if wac.sendQueue == nil {
+		wac.sendQueue = make(map[string]chan struct{})
+	}
+	prev := wac.sendQueue[jid]
+	wac.sendQueue[jid] = done
+	wac.sendQueueMutex.Unlock()
+
+	finish := func() {
+		wac.sendQueueMutex.Lock()
+		if wac.sendQueue[jid] == done {
+			delete(wac.sendQueue, jid)
+		}
+		wac.sendQueueMutex.Unlock()
+		close(done)
+	}
+
+	if prev != nil {
+		select {
+		case <-prev:
+		case <-ctx.Done():
+			// later sends are queued behind this one, so they may only proceed once the earlier sends are done
+			go func() {
+				<-prev
+				finish()
+			}()
+			return nil, ctx.Err()
+		}
+	}
+
+	return finish, nil
+}
+
+func getRemoteJid(msg interface{}) string {
+	switch m := msg.(type) {
+	case *proto.WebMessageInfo:
+		return m.GetKey().GetRemoteJid()
+	case MessageInfoGetter:
+		return m.GetInfo().RemoteJid
+	}
+	return ""
 }
 
+// getMessageSearchCount is the number of messages GetMessage loads from the server.
+const getMessageSearchCount = 50
+
 /*
 MessageInfo contains general message information. It is part of every of every message type.
 */
 type MessageInfo struct {
-	Id              string
-	RemoteJid       string
-	SenderJid       string
-	FromMe          bool
-	Timestamp       uint64
-	PushName        string
-	Status          MessageStatus
+	Id        string
+	RemoteJid string
+	// SenderJid is the author of the message: the participant that sent it in groups, the chat partner for received
+	// messages of 1:1 chats. It is empty for own messages unless the server names the sending device.
+	SenderJid string
+	FromMe    bool
+	Timestamp uint64
+	PushName  string
+	// Status is the delivery state of the message, e.g. DeliveryAck or Read for own messages. Messages that are sent
+	// without Status are sent as Pending.
+	Status MessageStatus
+	// QuotedMessageID is the id of the message this message replies to. Messages sent with a QuotedMessageID are
+	// shown as reply to that message, with the QuotedMessage as quoted bubble if it is set.
 	QuotedMessageID string
+	// QuotedParticipant is the author of the quoted message. When sending, it defaults to the sender of the
+	// QuotedMessage, to the own JID for own messages and to the RemoteJid of 1:1 chats. Quotes in groups require
+	// QuotedParticipant or a QuotedMessage with sender.
+	QuotedParticipant string
+	// QuotedMessage is the parsed message this message replies to. The QuotedMessage of a quoted message is always
+	// nil, its QuotedMessageID allows to follow the reply chain further with Conn.GetMessage.
+	QuotedMessage interface{}
+	// MentionedJids are the users mentioned in the text or caption of the message. When sending, the mentioned users
+	// are notified; the text has to contain "@<phone number>" for every mention to show it.
+	MentionedJids []string
+	// SenderPlatform is the platform the message was sent from, guessed from its id, see GetSenderPlatform.
+	SenderPlatform Platform
+	// Conversion is the attribution of messages that started a conversation from an ad, nil for other messages.
+	Conversion *Conversion
+	// Labels are the ids of the labels a business account attached to the message, empty for other accounts.
+	Labels []string
 
 	Source *proto.WebMessageInfo
 }
 
+/*
+Platform is the kind of client a message was sent from.
+*/
+type Platform string
+
+const (
+	PlatformUnknown Platform = ""
+	PlatformAndroid Platform = "android"
+	PlatformIOS     Platform = "ios"
+	PlatformWeb     Platform = "web"
+	PlatformDesktop Platform = "desktop"
+)
+
+/*
+GetSenderPlatform guesses the platform a message was sent from by the format of its id, as the protocol does not carry
+the platform of the sender. The WhatsApp clients generate ids of a different length and prefix: iOS ids are 20
+characters long and start with 3A, web ids are 22 characters long and start with 3E, Android ids have 21 or 32
+characters and desktop ids 18. The default ids of Send never start with 3A, so GetSenderPlatform returns
+PlatformUnknown for them. Ids in a format of SetMessageIdFormat that matches one of the client formats, ids of a
+Conn.MessageIDGenerator and ids of other libraries may look like any platform, the guess is best-effort and clients may
+change their format. Unknown formats return PlatformUnknown.
+*/
+func GetSenderPlatform(id string) Platform {
+	switch {
+	case len(id) == 20 && strings.HasPrefix(id, "3A"):
+		return PlatformIOS
+	case len(id) == 22 && strings.HasPrefix(id, "3E"):
+		return PlatformWeb
+	case len(id) == 21 || len(id) == 32:
+		return PlatformAndroid
+	case len(id) == 18:
+		return PlatformDesktop
+	}
+	return PlatformUnknown
+}
+
+/*
+Conversion is the ad attribution WhatsApp attaches to the first message of a user who started the chat from an ad, e.g.
+a click-to-WhatsApp ad. Source names where the user came from, Data is the opaque attribution data of the ad platform
+and DelaySeconds the time between the click and the message. The web protocol does not carry the ad card itself
+(title, body, thumbnail and source url).
+*/
+type Conversion struct {
+	Source       string
+	Data         []byte
+	DelaySeconds uint32
+}
+
+/*
+MessageInfoGetter is implemented by all message types of the package. It gives access to the MessageInfo of messages
+that are only known as interface{}, e.g. in middlewares.
+*/
+type MessageInfoGetter interface {
+	GetInfo() MessageInfo
+}
+
 type MessageStatus int
 
 const (
@@ -123,320 +705,1341 @@ const (
 )
 
 func getMessageInfo(msg *proto.WebMessageInfo) MessageInfo {
-	return MessageInfo{
-		Id:        msg.GetKey().GetId(),
-		RemoteJid: msg.GetKey().GetRemoteJid(),
-		SenderJid: msg.GetKey().GetParticipant(),
-		FromMe:    msg.GetKey().GetFromMe(),
-		Timestamp: msg.GetMessageTimestamp(),
-		Status:    MessageStatus(msg.GetStatus()),
-		PushName:  msg.GetPushName(),
-		Source:    msg,
+	info := MessageInfo{
+		Id:             msg.GetKey().GetId(),
+		RemoteJid:      msg.GetKey().GetRemoteJid(),
+		SenderJid:      getSenderJid(msg),
+		FromMe:         msg.GetKey().GetFromMe(),
+		Timestamp:      msg.GetMessageTimestamp(),
+		Status:         MessageStatus(msg.GetStatus()),
+		PushName:       msg.GetPushName(),
+		Labels:         msg.GetLabels(),
+		SenderPlatform: GetSenderPlatform(msg.GetKey().GetId()),
+		Source:         msg,
+	}
+
+	if ctx := getContextInfo(msg.GetMessage()); ctx != nil {
+		info.MentionedJids = ctx.GetMentionedJid()
+		info.QuotedMessageID = ctx.GetStanzaId()
+		info.QuotedParticipant = ctx.GetParticipant()
+		info.QuotedMessage = getQuotedMessage(msg, ctx)
+		if ctx.ConversionSource != nil {
+			info.Conversion = &Conversion{
+				Source:       ctx.GetConversionSource(),
+				Data:         ctx.GetConversionData(),
+				DelaySeconds: ctx.GetConversionDelaySeconds(),
+			}
+		}
 	}
+
+	return info
 }
 
-func getInfoProto(info *MessageInfo) *proto.WebMessageInfo {
-	if info.Id == "" || len(info.Id) < 2 {
-		b := make([]byte, 10)
-		rand.Read(b)
-		info.Id = strings.ToUpper(hex.EncodeToString(b))
+// getSenderJid returns the author of msg, which is the participant of messages in groups and broadcasts and the chat
+// itself for received messages of 1:1 chats. Own messages are only attributed if the server names the participant,
+// otherwise the sender is empty and FromMe identifies them.
+func getSenderJid(msg *proto.WebMessageInfo) string {
+	if participant := msg.GetKey().GetParticipant(); participant != "" {
+		return normalizeJid(participant)
 	}
-	if info.Timestamp == 0 {
-		info.Timestamp = uint64(time.Now().Unix())
+	if participant := msg.GetParticipant(); participant != "" {
+		return normalizeJid(participant)
 	}
-	info.FromMe = true
 
-	status := proto.WebMessageInfo_STATUS(info.Status)
+	remoteJid := msg.GetKey().GetRemoteJid()
+	if msg.GetKey().GetFromMe() || strings.HasSuffix(remoteJid, "@"+groupServer) || strings.HasSuffix(remoteJid, "@broadcast") {
+		return ""
+	}
+	return normalizeJid(remoteJid)
+}
+
+// getContextInfoProto returns the ContextInfo of an outgoing message with the given info, or nil if it needs none.
+func getContextInfoProto(info *MessageInfo) *proto.ContextInfo {
+	if len(info.MentionedJids) == 0 && info.QuotedMessageID == "" {
+		return nil
+	}
 
-	return &proto.WebMessageInfo{
-		Key: &proto.MessageKey{
-			FromMe:    &info.FromMe,
-			RemoteJid: &info.RemoteJid,
-			Id:        &info.Id,
-		},
-		MessageTimestamp: &info.Timestamp,
-		Status:           &status,
+	ctx := &proto.ContextInfo{MentionedJid: info.MentionedJids}
+	if info.QuotedMessageID != "" {
+		ctx.StanzaId = &info.QuotedMessageID
+
+		if m, ok := info.QuotedMessage.(MessageInfoGetter); ok {
+			if quoted := m.GetInfo(); quoted.Source.GetMessage() != nil {
+				ctx.QuotedMessage = []*proto.Message{quoted.Source.GetMessage()}
+			}
+		}
+
+		if info.QuotedParticipant != "" {
+			ctx.Participant = &info.QuotedParticipant
+		}
 	}
+	return ctx
+}
+
+func getContextInfo(msg *proto.Message) *proto.ContextInfo {
+	for _, ctx := range []*proto.ContextInfo{
+		msg.GetExtendedTextMessage().GetContextInfo(),
+		msg.GetImageMessage().GetContextInfo(),
+		msg.GetVideoMessage().GetContextInfo(),
+		msg.GetAudioMessage().GetContextInfo(),
+		msg.GetDocumentMessage().GetContextInfo(),
+		msg.GetContactMessage().GetContextInfo(),
+		msg.GetLocationMessage().GetContextInfo(),
+		msg.GetLiveLocationMessage().GetContextInfo(),
+		msg.GetStickerMessage().GetContextInfo(),
+		msg.GetContactsArrayMessage().GetContextInfo(),
+	} {
+		if ctx != nil {
+			return ctx
+		}
+	}
+	return nil
 }
 
 /*
-TextMessage represents a text message.
+getQuotedMessage parses the message quoted by msg. Quoted messages carry the complete message content, so quoted media
+messages can be downloaded like any other media message. Only one level of quotes is parsed: if the quoted message is
+a reply itself, its QuotedMessageID and the rest of its context info are kept, but its quoted message is dropped.
 */
-type TextMessage struct {
-	Info MessageInfo
-	Text string
+func getQuotedMessage(msg *proto.WebMessageInfo, ctx *proto.ContextInfo) interface{} {
+	if len(ctx.GetQuotedMessage()) == 0 || ctx.GetQuotedMessage()[0] == nil {
+		return nil
+	}
+
+	quoted := pb.Clone(ctx.GetQuotedMessage()[0]).(*proto.Message)
+	if quotedCtx := getContextInfo(quoted); quotedCtx != nil {
+		quotedCtx.QuotedMessage = nil
+	}
+
+	remoteJid := ctx.GetRemoteJid()
+	if remoteJid == "" {
+		remoteJid = msg.GetKey().GetRemoteJid()
+	}
+
+	return parseProtoMessage(&proto.WebMessageInfo{
+		Key: &proto.MessageKey{
+			RemoteJid:   &remoteJid,
+			Id:          ctx.StanzaId,
+			Participant: ctx.Participant,
+		},
+		Message: quoted,
+	})
 }
 
-func getTextMessage(msg *proto.WebMessageInfo) TextMessage {
-	text := TextMessage{Info: getMessageInfo(msg)}
-	if m := msg.GetMessage().GetExtendedTextMessage(); m != nil {
-		text.Text = m.GetText()
-		text.Info.QuotedMessageID = m.GetContextInfo().GetStanzaId()
-	} else {
-		text.Text = msg.GetMessage().GetConversation()
+// generateMessageId generates the default message ids, 10 random bytes as uppercase hex. The ids never start with 3A,
+// the prefix of iOS ids of the same length, so GetSenderPlatform does not take them for iOS ids.
+func generateMessageId() string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b [10]byte
+	rand.Read(b[:])
+	if b[0] == 0x3a {
+		b[0] ^= 0x80
 	}
-	return text
+
+	var id [20]byte
+	for i, v := range b {
+		id[i*2] = hexDigits[v>>4]
+		id[i*2+1] = hexDigits[v&0x0f]
+	}
+	return string(id[:])
 }
 
-func getTextProto(msg TextMessage) *proto.WebMessageInfo {
+/*
+SetMessageIdFormat changes the ids Send generates for messages without Id, unless Conn.MessageIDGenerator is set. An
+id consists of prefix followed by randomBytes random bytes, all encoded as uppercase hex digits like the ids of the
+WhatsApp clients. prefix may only contain the digits 0-9 and A-F, randomBytes has to be between 8 and 32. The default
+is no prefix and 10 random bytes, longer ids lower the probability of collisions for senders with a very high message
+volume. Calling it with an empty prefix and 10 random bytes restores the default. Ids of 18, 21 or 32 characters and ids
+starting with 3A or 3E look like ids of a WhatsApp client to GetSenderPlatform, see there.
+*/
+func (wac *Conn) SetMessageIdFormat(prefix string, randomBytes int) error {
+	for _, c := range prefix {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return fmt.Errorf("invalid message id prefix %q, only uppercase hex digits are allowed", prefix)
+		}
+	}
+	if randomBytes < 8 || randomBytes > 32 {
+		return fmt.Errorf("invalid number of random message id bytes %d, allowed are 8 to 32", randomBytes)
+	}
+
+	wac.messageIdMutex.Lock()
+	wac.messageIdPrefix = prefix
+	wac.messageIdBytes = randomBytes
+	wac.messageIdMutex.Unlock()
+	return nil
+}
+
+// newMessageId generates a message id with the MessageIDGenerator or in the format set with SetMessageIdFormat.
+func (wac *Conn) newMessageId() string {
+	if wac.MessageIDGenerator != nil {
+		return wac.MessageIDGenerator()
+	}
+
+	wac.messageIdMutex.RLock()
+	prefix, randomBytes := wac.messageIdPrefix, wac.messageIdBytes
+	wac.messageIdMutex.RUnlock()
+
+	if prefix == "" && (randomBytes == 0 || randomBytes == 10) {
+		return generateMessageId()
+	}
+
+	b := make([]byte, randomBytes)
+	rand.Read(b)
+	return prefix + strings.ToUpper(hex.EncodeToString(b))
+}
+
+// setMessageInfo sets the id, timestamp and push name of messages that are sent without them and the author of quoted
+// messages.
+func (wac *Conn) setMessageInfo(ctx context.Context, info *MessageInfo) error {
+	if info.Id == "" || len(info.Id) < 2 {
+		info.Id = wac.newMessageId()
+	}
+	if info.Timestamp == 0 {
+		ts, err := wac.nextTimestamp(ctx)
+		if err != nil {
+			return err
+		}
+		info.Timestamp = ts
+	}
+	if info.PushName == "" {
+		info.PushName = wac.PushName
+	}
+	if info.QuotedMessageID != "" && info.QuotedParticipant == "" {
+		participant, err := wac.getQuotedParticipant(info)
+		if err != nil {
+			return err
+		}
+		info.QuotedParticipant = participant
+	}
+	return nil
+}
+
+// getQuotedParticipant returns the author of the message info quotes: the sender of the QuotedMessage, the own JID for
+// own messages and the chat partner in 1:1 chats. In groups and broadcasts the author can not be guessed.
+func (wac *Conn) getQuotedParticipant(info *MessageInfo) (string, error) {
+	var quoted MessageInfo
+	if m, ok := info.QuotedMessage.(MessageInfoGetter); ok {
+		quoted = m.GetInfo()
+	}
+
+	switch {
+	case quoted.SenderJid != "":
+		return quoted.SenderJid, nil
+	case quoted.FromMe:
+		if wac.session == nil || wac.session.Wid == "" {
+			return "", fmt.Errorf("quoting an own message requires a session, set QuotedParticipant")
+		}
+		return normalizeJid(wac.session.Wid), nil
+	case strings.HasSuffix(info.RemoteJid, "@"+groupServer) || strings.HasSuffix(info.RemoteJid, "@"+broadcastServer):
+		return "", fmt.Errorf("unknown author of quoted message %s in %s, set QuotedParticipant", info.QuotedMessageID, info.RemoteJid)
+	}
+	return info.RemoteJid, nil
+}
+
+// setRawMessageInfo sets the id, timestamp and push name of protos that are sent without them, like setMessageInfo.
+func (wac *Conn) setRawMessageInfo(ctx context.Context, p *proto.WebMessageInfo) error {
+	if p.Key == nil {
+		p.Key = &proto.MessageKey{}
+	}
+	if len(p.Key.GetId()) < 2 {
+		id := wac.newMessageId()
+		p.Key.Id = &id
+	}
+	if p.Key.FromMe == nil {
+		fromMe := true
+		p.Key.FromMe = &fromMe
+	}
+	if p.GetMessageTimestamp() == 0 {
+		ts, err := wac.nextTimestamp(ctx)
+		if err != nil {
+			return err
+		}
+		p.MessageTimestamp = &ts
+	}
+	if p.PushName == nil && wac.PushName != "" {
+		pushName := wac.PushName
+		p.PushName = &pushName
+	}
+	return nil
+}
+
+// defaultMaxTimestampLead is the lead of nextTimestamp if Conn.MaxTimestampLead is not set.
+const defaultMaxTimestampLead = time.Minute
+
+// nextTimestamp returns the timestamp for the next sent message. Message timestamps only have a resolution of seconds,
+// so messages sent within the same second would get the same timestamp and may be shown out of order by the
+// recipients. nextTimestamp therefore returns strictly increasing timestamps, running ahead of the clock by one second
+// per message of a burst. Once the lead reaches MaxTimestampLead, nextTimestamp waits until the clock catches up or
+// ctx is done.
+func (wac *Conn) nextTimestamp(ctx context.Context) (uint64, error) {
+	lead := wac.MaxTimestampLead
+	if lead <= 0 {
+		lead = defaultMaxTimestampLead
+	}
+
+	for {
+		wac.timestampMutex.Lock()
+		now := time.Now()
+		ts := uint64(now.Unix())
+		if ts <= wac.lastTimestamp {
+			ts = wac.lastTimestamp + 1
+		}
+		ahead := time.Unix(int64(ts), 0).Sub(now)
+		if ahead <= lead {
+			wac.lastTimestamp = ts
+			wac.timestampMutex.Unlock()
+			return ts, nil
+		}
+		wac.timestampMutex.Unlock()
+
+		timer := time.NewTimer(ahead - lead)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func getInfoProto(info *MessageInfo) *proto.WebMessageInfo {
+	p := &proto.WebMessageInfo{}
+	setInfoProto(p, &proto.MessageKey{}, new(proto.WebMessageInfo_STATUS), info)
+	return p
+}
+
+// setInfoProto fills p with the values of info, using key and status as storage for the respective proto fields.
+func setInfoProto(p *proto.WebMessageInfo, key *proto.MessageKey, status *proto.WebMessageInfo_STATUS, info *MessageInfo) {
+	info.FromMe = true
+
+	// the zero value is the error status, messages that are sent without status are pending until the server acks
+	*status = proto.WebMessageInfo_STATUS(info.Status)
+	if info.Status == Error {
+		*status = proto.WebMessageInfo_PENDING
+	}
+
+	key.FromMe = &info.FromMe
+	key.RemoteJid = &info.RemoteJid
+	key.Id = &info.Id
+
+	p.Key = key
+	p.MessageTimestamp = &info.Timestamp
+	p.Status = status
+	if info.PushName != "" {
+		p.PushName = &info.PushName
+	}
+}
+
+/*
+TextMessage represents a text message. WhatsApp only shows the link preview card the sender attached to a message, the
+recipients do not fetch links themselves. The package does not fetch previews either, text messages are sent without
+preview unless LinkPreview is set.
+*/
+type TextMessage struct {
+	Info MessageInfo
+	Text string
+	// LinkPreview is the preview of a link in the text, nil for messages without preview.
+	LinkPreview *LinkPreview
+}
+
+/*
+LinkPreview is the preview card of a link in a text message. MatchedText is the link as it appears in the text,
+CanonicalUrl the url the preview was created for. Thumbnail is a small jpeg image.
+*/
+type LinkPreview struct {
+	MatchedText  string
+	CanonicalUrl string
+	Title        string
+	Description  string
+	Thumbnail    []byte
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m TextMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getTextMessage(msg *proto.WebMessageInfo) TextMessage {
+	text := TextMessage{Info: getMessageInfo(msg)}
+	if m := msg.GetMessage().GetExtendedTextMessage(); m != nil {
+		text.Text = m.GetText()
+		if m.MatchedText != nil || m.CanonicalUrl != nil || m.Title != nil {
+			text.LinkPreview = &LinkPreview{
+				MatchedText:  m.GetMatchedText(),
+				CanonicalUrl: m.GetCanonicalUrl(),
+				Title:        m.GetTitle(),
+				Description:  m.GetDescription(),
+				Thumbnail:    m.GetJpegThumbnail(),
+			}
+		}
+	} else {
+		text.Text = msg.GetMessage().GetConversation()
+	}
+	return text
+}
+
+// textProto holds everything a text message proto points to, so sending text messages needs only one allocation for
+// the proto instead of one per field.
+type textProto struct {
+	info    proto.WebMessageInfo
+	key     proto.MessageKey
+	status  proto.WebMessageInfo_STATUS
+	message proto.Message
+	msg     TextMessage
+}
+
+func getTextProto(msg TextMessage) *proto.WebMessageInfo {
+	t := &textProto{msg: msg}
+	setInfoProto(&t.info, &t.key, &t.status, &t.msg.Info)
+	if ctx := getContextInfoProto(&t.msg.Info); ctx != nil || t.msg.LinkPreview != nil {
+		t.message.ExtendedTextMessage = &proto.ExtendedTextMessage{
+			Text:        &t.msg.Text,
+			ContextInfo: ctx,
+		}
+		if preview := t.msg.LinkPreview; preview != nil {
+			t.message.ExtendedTextMessage.MatchedText = &preview.MatchedText
+			t.message.ExtendedTextMessage.CanonicalUrl = &preview.CanonicalUrl
+			t.message.ExtendedTextMessage.Title = &preview.Title
+			t.message.ExtendedTextMessage.Description = &preview.Description
+			t.message.ExtendedTextMessage.JpegThumbnail = preview.Thumbnail
+		}
+	} else {
+		t.message.Conversation = &t.msg.Text
+	}
+	t.info.Message = &t.message
+	return &t.info
+}
+
+/*
+ImageMessage represents a image message. Unexported fields are needed for media up/downloading and media validation.
+Provide a io.Reader as Content for message sending. Users mentioned in the caption are set as Info.MentionedJids. URLs in
+captions are shown as links, WhatsApp shows no link previews for media messages.
+*/
+type ImageMessage struct {
+	Info          MessageInfo
+	Caption       string
+	Thumbnail     []byte
+	Type          string
+	Content       io.Reader
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileSha256    []byte
+	fileLength    uint64
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m ImageMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getImageMessage(msg *proto.WebMessageInfo) ImageMessage {
+	image := msg.GetMessage().GetImageMessage()
+	return ImageMessage{
+		Info:          getMessageInfo(msg),
+		Caption:       image.GetCaption(),
+		Thumbnail:     image.GetJpegThumbnail(),
+		url:           image.GetUrl(),
+		mediaKey:      image.GetMediaKey(),
+		Type:          image.GetMimetype(),
+		fileEncSha256: image.GetFileEncSha256(),
+		fileSha256:    image.GetFileSha256(),
+		fileLength:    image.GetFileLength(),
+	}
+}
+
+func getImageProto(msg ImageMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		ImageMessage: &proto.ImageMessage{
+			ContextInfo:   getContextInfoProto(&msg.Info),
+			Caption:       &msg.Caption,
+			JpegThumbnail: msg.Thumbnail,
+			Url:           &msg.url,
+			MediaKey:      msg.mediaKey,
+			Mimetype:      &msg.Type,
+			FileEncSha256: msg.fileEncSha256,
+			FileSha256:    msg.fileSha256,
+			FileLength:    &msg.fileLength,
+		},
+	}
+	return p
+}
+
+/*
+Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+*/
+func (m *ImageMessage) Download() ([]byte, error) {
+	return Download(m.url, m.mediaKey, MediaImage, int(m.fileLength))
+}
+
+/*
+DownloadToWriter downloads the media and writes it to w without keeping it in memory, see DownloadToWriter.
+*/
+func (m *ImageMessage) DownloadToWriter(w io.Writer) (int64, error) {
+	return DownloadToWriter(w, m.url, m.mediaKey, MediaImage, int(m.fileLength))
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media data without decrypting it, see DownloadEncrypted.
+*/
+func (m *ImageMessage) DownloadEncrypted() ([]byte, error) {
+	return DownloadEncrypted(m.url, m.fileEncSha256)
+}
+
+/*
+MediaAvailable checks whether the media can still be downloaded, see MediaAvailable.
+*/
+func (m *ImageMessage) MediaAvailable() (bool, error) {
+	return MediaAvailable(m.url)
+}
+
+/*
+VideoMessage represents a video message. Unexported fields are needed for media up/downloading and media validation.
+Provide a io.Reader as Content for message sending. GIFs are sent as mp4 videos with GifPlayback set, which makes the
+apps play them automatically in a loop.
+*/
+type VideoMessage struct {
+	Info          MessageInfo
+	Caption       string
+	Thumbnail     []byte
+	Length        uint32
+	Type          string
+	Content       io.Reader
+	GifPlayback   bool
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileSha256    []byte
+	fileLength    uint64
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m VideoMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getVideoMessage(msg *proto.WebMessageInfo) VideoMessage {
+	vid := msg.GetMessage().GetVideoMessage()
+	return VideoMessage{
+		Info:          getMessageInfo(msg),
+		Caption:       vid.GetCaption(),
+		Thumbnail:     vid.GetJpegThumbnail(),
+		url:           vid.GetUrl(),
+		mediaKey:      vid.GetMediaKey(),
+		Length:        vid.GetSeconds(),
+		Type:          vid.GetMimetype(),
+		GifPlayback:   vid.GetGifPlayback(),
+		fileEncSha256: vid.GetFileEncSha256(),
+		fileSha256:    vid.GetFileSha256(),
+		fileLength:    vid.GetFileLength(),
+	}
+}
+
+func getVideoProto(msg VideoMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		VideoMessage: &proto.VideoMessage{
+			ContextInfo:   getContextInfoProto(&msg.Info),
+			Caption:       &msg.Caption,
+			JpegThumbnail: msg.Thumbnail,
+			Url:           &msg.url,
+			MediaKey:      msg.mediaKey,
+			Seconds:       &msg.Length,
+			FileEncSha256: msg.fileEncSha256,
+			FileSha256:    msg.fileSha256,
+			FileLength:    &msg.fileLength,
+			Mimetype:      &msg.Type,
+			GifPlayback:   &msg.GifPlayback,
+		},
+	}
+	return p
+}
+
+/*
+Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+*/
+func (m *VideoMessage) Download() ([]byte, error) {
+	return Download(m.url, m.mediaKey, MediaVideo, int(m.fileLength))
+}
+
+/*
+DownloadToWriter downloads the media and writes it to w without keeping it in memory, see DownloadToWriter.
+*/
+func (m *VideoMessage) DownloadToWriter(w io.Writer) (int64, error) {
+	return DownloadToWriter(w, m.url, m.mediaKey, MediaVideo, int(m.fileLength))
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media data without decrypting it, see DownloadEncrypted.
+*/
+func (m *VideoMessage) DownloadEncrypted() ([]byte, error) {
+	return DownloadEncrypted(m.url, m.fileEncSha256)
+}
+
+/*
+MediaAvailable checks whether the media can still be downloaded, see MediaAvailable.
+*/
+func (m *VideoMessage) MediaAvailable() (bool, error) {
+	return MediaAvailable(m.url)
+}
+
+/*
+AudioMessage represents a audio message. Unexported fields are needed for media up/downloading and media validation.
+Provide a io.Reader as Content for message sending.
+*/
+type AudioMessage struct {
+	Info          MessageInfo
+	Length        uint32
+	Type          string
+	Content       io.Reader
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileSha256    []byte
+	fileLength    uint64
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m AudioMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getAudioMessage(msg *proto.WebMessageInfo) AudioMessage {
+	aud := msg.GetMessage().GetAudioMessage()
+	return AudioMessage{
+		Info:          getMessageInfo(msg),
+		url:           aud.GetUrl(),
+		mediaKey:      aud.GetMediaKey(),
+		Length:        aud.GetSeconds(),
+		Type:          aud.GetMimetype(),
+		fileEncSha256: aud.GetFileEncSha256(),
+		fileSha256:    aud.GetFileSha256(),
+		fileLength:    aud.GetFileLength(),
+	}
+}
+
+func getAudioProto(msg AudioMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		AudioMessage: &proto.AudioMessage{
+			ContextInfo:   getContextInfoProto(&msg.Info),
+			Url:           &msg.url,
+			MediaKey:      msg.mediaKey,
+			Seconds:       &msg.Length,
+			FileEncSha256: msg.fileEncSha256,
+			FileSha256:    msg.fileSha256,
+			FileLength:    &msg.fileLength,
+			Mimetype:      &msg.Type,
+		},
+	}
+	return p
+}
+
+/*
+Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+*/
+func (m *AudioMessage) Download() ([]byte, error) {
+	return Download(m.url, m.mediaKey, MediaAudio, int(m.fileLength))
+}
+
+/*
+DownloadToWriter downloads the media and writes it to w without keeping it in memory, see DownloadToWriter.
+*/
+func (m *AudioMessage) DownloadToWriter(w io.Writer) (int64, error) {
+	return DownloadToWriter(w, m.url, m.mediaKey, MediaAudio, int(m.fileLength))
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media data without decrypting it, see DownloadEncrypted.
+*/
+func (m *AudioMessage) DownloadEncrypted() ([]byte, error) {
+	return DownloadEncrypted(m.url, m.fileEncSha256)
+}
+
+/*
+MediaAvailable checks whether the media can still be downloaded, see MediaAvailable.
+*/
+func (m *AudioMessage) MediaAvailable() (bool, error) {
+	return MediaAvailable(m.url)
+}
+
+/*
+DocumentMessage represents a document message. Unexported fields are needed for media up/downloading and media
+validation. Provide a io.Reader as Content for message sending.
+*/
+type DocumentMessage struct {
+	Info          MessageInfo
+	Title         string
+	PageCount     uint32
+	Type          string
+	Thumbnail     []byte
+	Content       io.Reader
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileSha256    []byte
+	fileLength    uint64
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m DocumentMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getDocumentMessage(msg *proto.WebMessageInfo) DocumentMessage {
+	doc := msg.GetMessage().GetDocumentMessage()
+	return DocumentMessage{
+		Info:          getMessageInfo(msg),
+		Thumbnail:     doc.GetJpegThumbnail(),
+		url:           doc.GetUrl(),
+		mediaKey:      doc.GetMediaKey(),
+		fileEncSha256: doc.GetFileEncSha256(),
+		fileSha256:    doc.GetFileSha256(),
+		fileLength:    doc.GetFileLength(),
+		PageCount:     doc.GetPageCount(),
+		Title:         doc.GetTitle(),
+		Type:          doc.GetMimetype(),
+	}
+}
+
+func getDocumentProto(msg DocumentMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		DocumentMessage: &proto.DocumentMessage{
+			ContextInfo:   getContextInfoProto(&msg.Info),
+			JpegThumbnail: msg.Thumbnail,
+			Url:           &msg.url,
+			MediaKey:      msg.mediaKey,
+			FileEncSha256: msg.fileEncSha256,
+			FileSha256:    msg.fileSha256,
+			FileLength:    &msg.fileLength,
+			PageCount:     &msg.PageCount,
+			Title:         &msg.Title,
+			Mimetype:      &msg.Type,
+		},
+	}
+	return p
+}
+
+/*
+Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+*/
+func (m *DocumentMessage) Download() ([]byte, error) {
+	return Download(m.url, m.mediaKey, MediaDocument, int(m.fileLength))
+}
+
+/*
+DownloadToWriter downloads the media and writes it to w without keeping it in memory, see DownloadToWriter.
+*/
+func (m *DocumentMessage) DownloadToWriter(w io.Writer) (int64, error) {
+	return DownloadToWriter(w, m.url, m.mediaKey, MediaDocument, int(m.fileLength))
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media data without decrypting it, see DownloadEncrypted.
+*/
+func (m *DocumentMessage) DownloadEncrypted() ([]byte, error) {
+	return DownloadEncrypted(m.url, m.fileEncSha256)
+}
+
+/*
+MediaAvailable checks whether the media can still be downloaded, see MediaAvailable.
+*/
+func (m *DocumentMessage) MediaAvailable() (bool, error) {
+	return MediaAvailable(m.url)
+}
+
+/*
+StickerMessage represents a sticker. Stickers are 512x512 WebP images, Send rejects other content before uploading it.
+Stickers are encrypted with the keys of images (MediaImage). Thumbnail is a small png image. Unexported fields are
+needed for media up/downloading and media validation. Provide a io.Reader as Content for message sending.
+*/
+type StickerMessage struct {
+	Info          MessageInfo
+	Thumbnail     []byte
+	Type          string
+	Width         uint32
+	Height        uint32
+	Content       io.Reader
+	url           string
+	mediaKey      []byte
+	fileEncSha256 []byte
+	fileSha256    []byte
+	fileLength    uint64
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m StickerMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getStickerMessage(msg *proto.WebMessageInfo) StickerMessage {
+	sticker := msg.GetMessage().GetStickerMessage()
+	return StickerMessage{
+		Info:          getMessageInfo(msg),
+		Thumbnail:     sticker.GetPngThumbnail(),
+		Type:          sticker.GetMimetype(),
+		Width:         sticker.GetWidth(),
+		Height:        sticker.GetHeight(),
+		url:           sticker.GetUrl(),
+		mediaKey:      sticker.GetMediaKey(),
+		fileEncSha256: sticker.GetFileEncSha256(),
+		fileSha256:    sticker.GetFileSha256(),
+		fileLength:    sticker.GetFileLength(),
+	}
+}
+
+func getStickerProto(msg StickerMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		StickerMessage: &proto.StickerMessage{
+			ContextInfo:   getContextInfoProto(&msg.Info),
+			PngThumbnail:  msg.Thumbnail,
+			Url:           &msg.url,
+			MediaKey:      msg.mediaKey,
+			Mimetype:      &msg.Type,
+			Width:         &msg.Width,
+			Height:        &msg.Height,
+			FileEncSha256: msg.fileEncSha256,
+			FileSha256:    msg.fileSha256,
+			FileLength:    &msg.fileLength,
+		},
+	}
+	return p
+}
+
+/*
+Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+*/
+func (m *StickerMessage) Download() ([]byte, error) {
+	return Download(m.url, m.mediaKey, MediaImage, int(m.fileLength))
+}
+
+/*
+DownloadToWriter downloads the media and writes it to w without keeping it in memory, see DownloadToWriter.
+*/
+func (m *StickerMessage) DownloadToWriter(w io.Writer) (int64, error) {
+	return DownloadToWriter(w, m.url, m.mediaKey, MediaImage, int(m.fileLength))
+}
+
+/*
+DownloadEncrypted retrieves the encrypted media data without decrypting it, see DownloadEncrypted.
+*/
+func (m *StickerMessage) DownloadEncrypted() ([]byte, error) {
+	return DownloadEncrypted(m.url, m.fileEncSha256)
+}
+
+/*
+MediaAvailable checks whether the media can still be downloaded, see MediaAvailable.
+*/
+func (m *StickerMessage) MediaAvailable() (bool, error) {
+	return MediaAvailable(m.url)
+}
+
+/*
+ContactMessage represents a message sharing a contact. Vcard is the contact in vCard format, DisplayName the name shown
+in the chat. The vCard is sent as it is.
+*/
+type ContactMessage struct {
+	Info        MessageInfo
+	DisplayName string
+	Vcard       string
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m ContactMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getContactMessage(msg *proto.WebMessageInfo) ContactMessage {
+	contact := msg.GetMessage().GetContactMessage()
+	return ContactMessage{
+		Info:        getMessageInfo(msg),
+		DisplayName: contact.GetDisplayName(),
+		Vcard:       contact.GetVcard(),
+	}
+}
+
+func getContactProto(msg ContactMessage) *proto.WebMessageInfo {
+	p := getInfoProto(&msg.Info)
+	p.Message = &proto.Message{
+		ContactMessage: &proto.ContactMessage{
+			DisplayName: &msg.DisplayName,
+			Vcard:       &msg.Vcard,
+			ContextInfo: getContextInfoProto(&msg.Info),
+		},
+	}
+	return p
+}
+
+/*
+ContactsArrayMessage represents a message sharing several contacts at once. DisplayName is the name shown in the chat,
+e.g. "3 contacts". Only DisplayName and Vcard of the Contacts are used, their Info is ignored.
+*/
+type ContactsArrayMessage struct {
+	Info        MessageInfo
+	DisplayName string
+	Contacts    []ContactMessage
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m ContactsArrayMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getContactsArrayMessage(msg *proto.WebMessageInfo) ContactsArrayMessage {
+	contacts := msg.GetMessage().GetContactsArrayMessage()
+	m := ContactsArrayMessage{
+		Info:        getMessageInfo(msg),
+		DisplayName: contacts.GetDisplayName(),
+	}
+	for _, c := range contacts.GetContacts() {
+		m.Contacts = append(m.Contacts, ContactMessage{DisplayName: c.GetDisplayName(), Vcard: c.GetVcard()})
+	}
+	return m
+}
+
+func getContactsArrayProto(msg ContactsArrayMessage) *proto.WebMessageInfo {
+	contacts := make([]*proto.ContactMessage, len(msg.Contacts))
+	for i := range msg.Contacts {
+		contacts[i] = &proto.ContactMessage{
+			DisplayName: &msg.Contacts[i].DisplayName,
+			Vcard:       &msg.Contacts[i].Vcard,
+		}
+	}
+
 	p := getInfoProto(&msg.Info)
 	p.Message = &proto.Message{
-		Conversation: &msg.Text,
+		ContactsArrayMessage: &proto.ContactsArrayMessage{
+			DisplayName: &msg.DisplayName,
+			Contacts:    contacts,
+			ContextInfo: getContextInfoProto(&msg.Info),
+		},
 	}
 	return p
 }
 
 /*
-ImageMessage represents a image message. Unexported fields are needed for media up/downloading and media validation.
-Provide a io.Reader as Content for message sending.
+LocationMessage represents a static location. Name and Address describe the place, Url links to it. Thumbnail is a
+small jpeg image of the map. Send rejects coordinates that are not a valid latitude and longitude.
 */
-type ImageMessage struct {
-	Info          MessageInfo
-	Caption       string
-	Thumbnail     []byte
-	Type          string
-	Content       io.Reader
-	url           string
-	mediaKey      []byte
-	fileEncSha256 []byte
-	fileSha256    []byte
-	fileLength    uint64
+type LocationMessage struct {
+	Info             MessageInfo
+	DegreesLatitude  float64
+	DegreesLongitude float64
+	Name             string
+	Address          string
+	Url              string
+	Thumbnail        []byte
 }
 
-func getImageMessage(msg *proto.WebMessageInfo) ImageMessage {
-	image := msg.GetMessage().GetImageMessage()
-	return ImageMessage{
-		Info:          getMessageInfo(msg),
-		Caption:       image.GetCaption(),
-		Thumbnail:     image.GetJpegThumbnail(),
-		url:           image.GetUrl(),
-		mediaKey:      image.GetMediaKey(),
-		Type:          image.GetMimetype(),
-		fileEncSha256: image.GetFileEncSha256(),
-		fileSha256:    image.GetFileSha256(),
-		fileLength:    image.GetFileLength(),
+// GetInfo returns the MessageInfo of the message.
+func (m LocationMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getLocationMessage(msg *proto.WebMessageInfo) LocationMessage {
+	loc := msg.GetMessage().GetLocationMessage()
+	return LocationMessage{
+		Info:             getMessageInfo(msg),
+		DegreesLatitude:  loc.GetDegreesLatitude(),
+		DegreesLongitude: loc.GetDegreesLongitude(),
+		Name:             loc.GetName(),
+		Address:          loc.GetAddress(),
+		Url:              loc.GetUrl(),
+		Thumbnail:        loc.GetJpegThumbnail(),
 	}
 }
 
-func getImageProto(msg ImageMessage) *proto.WebMessageInfo {
+func getLocationProto(msg LocationMessage) *proto.WebMessageInfo {
 	p := getInfoProto(&msg.Info)
 	p.Message = &proto.Message{
-		ImageMessage: &proto.ImageMessage{
-			Caption:       &msg.Caption,
-			JpegThumbnail: msg.Thumbnail,
-			Url:           &msg.url,
-			MediaKey:      msg.mediaKey,
-			Mimetype:      &msg.Type,
-			FileEncSha256: msg.fileEncSha256,
-			FileSha256:    msg.fileSha256,
-			FileLength:    &msg.fileLength,
+		LocationMessage: &proto.LocationMessage{
+			DegreesLatitude:  &msg.DegreesLatitude,
+			DegreesLongitude: &msg.DegreesLongitude,
+			Name:             &msg.Name,
+			Address:          &msg.Address,
+			Url:              &msg.Url,
+			JpegThumbnail:    msg.Thumbnail,
+			ContextInfo:      getContextInfoProto(&msg.Info),
 		},
 	}
 	return p
 }
 
 /*
-Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+LiveLocationMessage represents a shared live location. A share is updated by sending further LiveLocationMessages with
+the Info.Id of the first message (e.g. as returned by SendWithContext) and an increasing SequenceNumber; the recipients
+replace the location of the share with the update instead of showing a new message.
 */
-func (m *ImageMessage) Download() ([]byte, error) {
-	return Download(m.url, m.mediaKey, MediaImage, int(m.fileLength))
+type LiveLocationMessage struct {
+	Info                              MessageInfo
+	DegreesLatitude                   float64
+	DegreesLongitude                  float64
+	AccuracyInMeters                  uint32
+	SpeedInMps                        float32
+	DegreesClockwiseFromMagneticNorth uint32
+	Caption                           string
+	SequenceNumber                    int64
+	Thumbnail                         []byte
 }
 
-/*
-VideoMessage represents a video message. Unexported fields are needed for media up/downloading and media validation.
-Provide a io.Reader as Content for message sending.
-*/
-type VideoMessage struct {
-	Info          MessageInfo
-	Caption       string
-	Thumbnail     []byte
-	Length        uint32
-	Type          string
-	Content       io.Reader
-	url           string
-	mediaKey      []byte
-	fileEncSha256 []byte
-	fileSha256    []byte
-	fileLength    uint64
+// GetInfo returns the MessageInfo of the message.
+func (m LiveLocationMessage) GetInfo() MessageInfo {
+	return m.Info
 }
 
-func getVideoMessage(msg *proto.WebMessageInfo) VideoMessage {
-	vid := msg.GetMessage().GetVideoMessage()
-	return VideoMessage{
-		Info:          getMessageInfo(msg),
-		Caption:       vid.GetCaption(),
-		Thumbnail:     vid.GetJpegThumbnail(),
-		url:           vid.GetUrl(),
-		mediaKey:      vid.GetMediaKey(),
-		Length:        vid.GetSeconds(),
-		Type:          vid.GetMimetype(),
-		fileEncSha256: vid.GetFileEncSha256(),
-		fileSha256:    vid.GetFileSha256(),
-		fileLength:    vid.GetFileLength(),
+func getLiveLocationMessage(msg *proto.WebMessageInfo) LiveLocationMessage {
+	loc := msg.GetMessage().GetLiveLocationMessage()
+	return LiveLocationMessage{
+		Info:                              getMessageInfo(msg),
+		DegreesLatitude:                   loc.GetDegreesLatitude(),
+		DegreesLongitude:                  loc.GetDegreesLongitude(),
+		AccuracyInMeters:                  loc.GetAccuracyInMeters(),
+		SpeedInMps:                        loc.GetSpeedInMps(),
+		DegreesClockwiseFromMagneticNorth: loc.GetDegreesClockwiseFromMagneticNorth(),
+		Caption:                           loc.GetCaption(),
+		SequenceNumber:                    loc.GetSequenceNumber(),
+		Thumbnail:                         loc.GetJpegThumbnail(),
 	}
 }
 
-func getVideoProto(msg VideoMessage) *proto.WebMessageInfo {
+func getLiveLocationProto(msg LiveLocationMessage) *proto.WebMessageInfo {
 	p := getInfoProto(&msg.Info)
 	p.Message = &proto.Message{
-		VideoMessage: &proto.VideoMessage{
-			Caption:       &msg.Caption,
-			JpegThumbnail: msg.Thumbnail,
-			Url:           &msg.url,
-			MediaKey:      msg.mediaKey,
-			Seconds:       &msg.Length,
-			FileEncSha256: msg.fileEncSha256,
-			FileSha256:    msg.fileSha256,
-			FileLength:    &msg.fileLength,
-			Mimetype:      &msg.Type,
+		LiveLocationMessage: &proto.LiveLocationMessage{
+			DegreesLatitude:                   &msg.DegreesLatitude,
+			DegreesLongitude:                  &msg.DegreesLongitude,
+			AccuracyInMeters:                  &msg.AccuracyInMeters,
+			SpeedInMps:                        &msg.SpeedInMps,
+			DegreesClockwiseFromMagneticNorth: &msg.DegreesClockwiseFromMagneticNorth,
+			Caption:                           &msg.Caption,
+			SequenceNumber:                    &msg.SequenceNumber,
+			JpegThumbnail:                     msg.Thumbnail,
+			ContextInfo:                       getContextInfoProto(&msg.Info),
 		},
 	}
 	return p
 }
 
-/*
-Download is the function to retrieve media data. The media gets downloaded, validated and returned.
-*/
-func (m *VideoMessage) Download() ([]byte, error) {
-	return Download(m.url, m.mediaKey, MediaVideo, int(m.fileLength))
+// validateCoordinates checks that latitude and longitude are finite and within [-90, 90] and [-180, 180] degrees.
+func validateCoordinates(latitude, longitude float64) error {
+	if math.IsNaN(latitude) || math.IsNaN(longitude) || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return fmt.Errorf("invalid coordinates: latitude %v, longitude %v", latitude, longitude)
+	}
+	return nil
 }
 
 /*
-AudioMessage represents a audio message. Unexported fields are needed for media up/downloading and media validation.
-Provide a io.Reader as Content for message sending.
+TemplateMessage represents a highly structured (HSM) message, a notification template of a business account. Namespace
+and ElementName identify the template, Params are substituted into its placeholders in order. FallbackLg and FallbackLc
+are the language and locale of the template, e.g. "en" and "US". Templates have to be created and approved for the
+business account beforehand, the server rejects templates that are not approved. The web protocol has no template
+buttons, so neither buttons nor button responses are supported.
 */
-type AudioMessage struct {
-	Info          MessageInfo
-	Length        uint32
-	Type          string
-	Content       io.Reader
-	url           string
-	mediaKey      []byte
-	fileEncSha256 []byte
-	fileSha256    []byte
-	fileLength    uint64
+type TemplateMessage struct {
+	Info        MessageInfo
+	Namespace   string
+	ElementName string
+	Params      []string
+	FallbackLg  string
+	FallbackLc  string
 }
 
-func getAudioMessage(msg *proto.WebMessageInfo) AudioMessage {
-	aud := msg.GetMessage().GetAudioMessage()
-	return AudioMessage{
-		Info:          getMessageInfo(msg),
-		url:           aud.GetUrl(),
-		mediaKey:      aud.GetMediaKey(),
-		Length:        aud.GetSeconds(),
-		Type:          aud.GetMimetype(),
-		fileEncSha256: aud.GetFileEncSha256(),
-		fileSha256:    aud.GetFileSha256(),
-		fileLength:    aud.GetFileLength(),
+// GetInfo returns the MessageInfo of the message.
+func (m TemplateMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+func getTemplateMessage(msg *proto.WebMessageInfo) TemplateMessage {
+	hsm := msg.GetMessage().GetHighlyStructuredMessage()
+	return TemplateMessage{
+		Info:        getMessageInfo(msg),
+		Namespace:   hsm.GetNamespace(),
+		ElementName: hsm.GetElementName(),
+		Params:      hsm.GetParams(),
+		FallbackLg:  hsm.GetFallbackLg(),
+		FallbackLc:  hsm.GetFallbackLc(),
 	}
 }
 
-func getAudioProto(msg AudioMessage) *proto.WebMessageInfo {
+func getTemplateProto(msg TemplateMessage) *proto.WebMessageInfo {
 	p := getInfoProto(&msg.Info)
 	p.Message = &proto.Message{
-		AudioMessage: &proto.AudioMessage{
-			Url:           &msg.url,
-			MediaKey:      msg.mediaKey,
-			Seconds:       &msg.Length,
-			FileEncSha256: msg.fileEncSha256,
-			FileSha256:    msg.fileSha256,
-			FileLength:    &msg.fileLength,
-			Mimetype:      &msg.Type,
+		HighlyStructuredMessage: &proto.HighlyStructuredMessage{
+			Namespace:   &msg.Namespace,
+			ElementName: &msg.ElementName,
+			Params:      msg.Params,
+			FallbackLg:  &msg.FallbackLg,
+			FallbackLc:  &msg.FallbackLc,
 		},
 	}
 	return p
 }
 
 /*
-Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+PlaceholderMessage represents a message whose content is empty because it has not been synced from the phone yet. Only
+the MessageInfo is known. The content can be loaded later on with GetMessage or LoadMessages.
 */
-func (m *AudioMessage) Download() ([]byte, error) {
-	return Download(m.url, m.mediaKey, MediaAudio, int(m.fileLength))
+type PlaceholderMessage struct {
+	Info MessageInfo
+}
+
+// GetInfo returns the MessageInfo of the message.
+func (m PlaceholderMessage) GetInfo() MessageInfo {
+	return m.Info
 }
 
 /*
-DocumentMessage represents a document message. Unexported fields are needed for media up/downloading and media
-validation. Provide a io.Reader as Content for message sending.
+RevokedMessage represents the deletion of a message for everyone by its sender. RevokedMessageID is the id of the
+deleted message in the chat Info.RemoteJid. WhatsApp Web does not support editing messages, there is no counterpart for
+edited messages.
 */
-type DocumentMessage struct {
-	Info          MessageInfo
-	Title         string
-	PageCount     uint32
-	Type          string
-	Thumbnail     []byte
-	Content       io.Reader
-	url           string
-	mediaKey      []byte
-	fileEncSha256 []byte
-	fileSha256    []byte
-	fileLength    uint64
+type RevokedMessage struct {
+	Info             MessageInfo
+	RevokedMessageID string
 }
 
-func getDocumentMessage(msg *proto.WebMessageInfo) DocumentMessage {
-	doc := msg.GetMessage().GetDocumentMessage()
-	return DocumentMessage{
-		Info:          getMessageInfo(msg),
-		Thumbnail:     doc.GetJpegThumbnail(),
-		url:           doc.GetUrl(),
-		mediaKey:      doc.GetMediaKey(),
-		fileEncSha256: doc.GetFileEncSha256(),
-		fileSha256:    doc.GetFileSha256(),
-		fileLength:    doc.GetFileLength(),
-		PageCount:     doc.GetPageCount(),
-		Title:         doc.GetTitle(),
-		Type:          doc.GetMimetype(),
-	}
+// GetInfo returns the MessageInfo of the message.
+func (m RevokedMessage) GetInfo() MessageInfo {
+	return m.Info
 }
 
-func getDocumentProto(msg DocumentMessage) *proto.WebMessageInfo {
-	p := getInfoProto(&msg.Info)
-	p.Message = &proto.Message{
-		DocumentMessage: &proto.DocumentMessage{
-			JpegThumbnail: msg.Thumbnail,
-			Url:           &msg.url,
-			MediaKey:      msg.mediaKey,
-			FileEncSha256: msg.fileEncSha256,
-			FileSha256:    msg.fileSha256,
-			FileLength:    &msg.fileLength,
-			PageCount:     &msg.PageCount,
-			Title:         &msg.Title,
-			Mimetype:      &msg.Type,
-		},
+// getRevokedMessage parses revoke protocol messages as well as the revoke stubs that replace deleted messages in the
+// chat history. The key of a protocol message references the deleted message, a stub has the key of the deleted
+// message itself.
+func getRevokedMessage(msg *proto.WebMessageInfo) RevokedMessage {
+	revoked := RevokedMessage{Info: getMessageInfo(msg)}
+	if pm := msg.GetMessage().GetProtocolMessage(); pm != nil {
+		revoked.RevokedMessageID = pm.GetKey().GetId()
+	} else {
+		revoked.RevokedMessageID = msg.GetKey().GetId()
 	}
-	return p
+	return revoked
 }
 
 /*
-Download is the function to retrieve media data. The media gets downloaded, validated and returned.
+MessageKind classifies incoming messages by their content. It is used to select which messages are parsed and
+dispatched to the handlers, see SetHandledTypes.
 */
-func (m *DocumentMessage) Download() ([]byte, error) {
-	return Download(m.url, m.mediaKey, MediaDocument, int(m.fileLength))
-}
+type MessageKind int
 
-func parseProtoMessage(msg *proto.WebMessageInfo) interface{} {
+const (
+	KindUnknown MessageKind = iota
+	KindText
+	KindImage
+	KindVideo
+	KindAudio
+	KindDocument
+	KindPlaceholder
+	KindRevoked
+	KindTemplate
+	KindContact
+	KindContactsArray
+	KindLocation
+	KindLiveLocation
+	KindSticker
+)
+
+func getMessageKind(msg *proto.WebMessageInfo) MessageKind {
 	switch {
 
 	case msg.GetMessage().GetAudioMessage() != nil:
-		return getAudioMessage(msg)
+		return KindAudio
 
 	case msg.GetMessage().GetImageMessage() != nil:
-		return getImageMessage(msg)
+		return KindImage
 
 	case msg.GetMessage().GetVideoMessage() != nil:
-		return getVideoMessage(msg)
+		return KindVideo
 
 	case msg.GetMessage().GetDocumentMessage() != nil:
-		return getDocumentMessage(msg)
+		return KindDocument
 
 	case msg.GetMessage().GetConversation() != "":
-		return getTextMessage(msg)
+		return KindText
 
 	case msg.GetMessage().GetExtendedTextMessage() != nil:
-		return getTextMessage(msg)
+		return KindText
+
+	case msg.GetMessage().GetHighlyStructuredMessage() != nil:
+		return KindTemplate
+
+	case msg.GetMessage().GetContactMessage() != nil:
+		return KindContact
+
+	case msg.GetMessage().GetContactsArrayMessage() != nil:
+		return KindContactsArray
+
+	case msg.GetMessage().GetLocationMessage() != nil:
+		return KindLocation
+
+	case msg.GetMessage().GetLiveLocationMessage() != nil:
+		return KindLiveLocation
+
+	case msg.GetMessage().GetStickerMessage() != nil:
+		return KindSticker
+
+	case msg.GetMessage().GetProtocolMessage() != nil && msg.GetMessage().GetProtocolMessage().GetType() == proto.ProtocolMessage_REVOKE:
+		return KindRevoked
+
+	case msg.GetMessageStubType() == proto.WebMessageInfo_REVOKE:
+		return KindRevoked
+
+	case msg.GetMessage() != nil && pb.Size(msg.GetMessage()) == 0:
+		return KindPlaceholder
 
 	default:
 		//cannot match message
 	}
 
+	return KindUnknown
+}
+
+func parseProtoMessage(msg *proto.WebMessageInfo) interface{} {
+	switch getMessageKind(msg) {
+
+	case KindAudio:
+		return getAudioMessage(msg)
+
+	case KindImage:
+		return getImageMessage(msg)
+
+	case KindVideo:
+		return getVideoMessage(msg)
+
+	case KindDocument:
+		return getDocumentMessage(msg)
+
+	case KindText:
+		return getTextMessage(msg)
+
+	case KindPlaceholder:
+		return PlaceholderMessage{Info: getMessageInfo(msg)}
+
+	case KindRevoked:
+		return getRevokedMessage(msg)
+
+	case KindTemplate:
+		return getTemplateMessage(msg)
+
+	case KindContact:
+		return getContactMessage(msg)
+
+	case KindContactsArray:
+		return getContactsArrayMessage(msg)
+
+	case KindLocation:
+		return getLocationMessage(msg)
+
+	case KindLiveLocation:
+		return getLiveLocationMessage(msg)
+
+	case KindSticker:
+		return getStickerMessage(msg)
+
+	}
+
 	return nil
 }
+
+/*
+Reply sends text as a reply to the message to. The message to can be any message type of the package, e.g. a message
+received by a handler. The reply quotes the original message and is sent to the chat the original message belongs to.
+*/
+func (wac *Conn) Reply(to interface{}, text string) error {
+	m, ok := to.(MessageInfoGetter)
+	if !ok {
+		return fmt.Errorf("cannot reply to type %T, use message types declared in the package", to)
+	}
+	original := m.GetInfo()
+
+	return wac.Send(TextMessage{
+		Info: MessageInfo{
+			RemoteJid:       original.RemoteJid,
+			QuotedMessageID: original.Id,
+			QuotedMessage:   to,
+		},
+		Text: text,
+	})
+}
+
+/*
+RevokeMessage deletes the message with id msgID in the chat remoteJid for everyone and returns the id of the revoke
+message. fromMe has to match the message, only own messages can be revoked. Recipients receive a RevokedMessage.
+*/
+func (wac *Conn) RevokeMessage(remoteJid, msgID string, fromMe bool) (string, error) {
+	revokeType := proto.ProtocolMessage_REVOKE
+	p := &proto.WebMessageInfo{
+		Key: &proto.MessageKey{RemoteJid: &remoteJid},
+		Message: &proto.Message{
+			ProtocolMessage: &proto.ProtocolMessage{
+				Key: &proto.MessageKey{
+					RemoteJid: &remoteJid,
+					FromMe:    &fromMe,
+					Id:        &msgID,
+				},
+				Type: &revokeType,
+			},
+		},
+	}
+	return wac.send(context.Background(), p)
+}
+
+/*
+GetMessage returns the message with the given id in the chat remoteJid, parsed like the messages passed to the
+handlers. Messages are looked up in the Store first, which keeps the last messages received or sent on this
+connection (see Store). If the message is not found there, the latest messages of the chat are loaded from the
+server and searched. Older messages can be loaded with LoadMessagesBefore. If the message is found but its kind is
+not supported, the raw *proto.WebMessageInfo is returned.
+*/
+func (wac *Conn) GetMessage(remoteJid, messageId string) (interface{}, error) {
+	p := wac.Store.getMessage(remoteJid, messageId)
+	if p == nil {
+		var err error
+		if p, err = wac.loadMessage(remoteJid, messageId); err != nil {
+			return nil, err
+		}
+	}
+
+	if m := parseProtoMessage(p); m != nil {
+		return m, nil
+	}
+	return p, nil
+}
+
+// loadMessage searches the latest messages of the chat remoteJid on the server for the message with the given id.
+func (wac *Conn) loadMessage(remoteJid, messageId string) (*proto.WebMessageInfo, error) {
+	node, err := wac.LoadMessages(remoteJid, "", getMessageSearchCount)
+	if err != nil {
+		return nil, fmt.Errorf("error loading messages: %v", err)
+	}
+	content, _ := node.Content.([]interface{})
+	for _, c := range content {
+		if m, ok := c.(*proto.WebMessageInfo); ok && m.GetKey().GetId() == messageId {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("message %s not found in %s", messageId, remoteJid)
+}
+
+/*
+QueryMessageStatus returns the current delivery state of the message with the given id in the chat remoteJid, e.g.
+DeliveryAck or Read for own messages. WhatsApp Web has no query for the state of a single message, instead the latest
+messages of the chat are loaded from the server, which carry their current state. Messages that are not among these
+messages are looked up in the Store (see GetMessage), whose state may be outdated.
+*/
+func (wac *Conn) QueryMessageStatus(remoteJid, messageId string) (MessageStatus, error) {
+	p, err := wac.loadMessage(remoteJid, messageId)
+	if err != nil {
+		if p = wac.Store.getMessage(remoteJid, messageId); p == nil {
+			return Error, err
+		}
+		return MessageStatus(p.GetStatus()), nil
+	}
+
+	wac.Store.addMessage(p)
+	return MessageStatus(p.GetStatus()), nil
+}
@@ -0,0 +1,887 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetTextProto(t *testing.T) {
+	msg := TextMessage{
+		Info: MessageInfo{
+			RemoteJid: "491234567890@s.whatsapp.net",
+		},
+		Text: "Hello Whatsapp",
+	}
+
+	wac := &Conn{}
+	p, err := wac.BuildProto(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile("^[0-9A-F]{20}$").MatchString(p.GetKey().GetId()) {
+		t.Errorf("invalid message id %q", p.GetKey().GetId())
+	}
+	if p.GetKey().GetRemoteJid() != msg.Info.RemoteJid || !p.GetKey().GetFromMe() {
+		t.Errorf("invalid message key %v", p.GetKey())
+	}
+	if p.GetMessageTimestamp() == 0 {
+		t.Error("message timestamp not set")
+	}
+	if p.GetMessage().GetConversation() != msg.Text {
+		t.Errorf("invalid text %q", p.GetMessage().GetConversation())
+	}
+	if p2, _ := wac.BuildProto(msg); p2.GetKey().GetId() == p.GetKey().GetId() {
+		t.Error("message ids are not unique")
+	}
+}
+
+func TestParsePlaceholderMessage(t *testing.T) {
+	remoteJid, id := "491234567890@s.whatsapp.net", "ID"
+	msg := parseProtoMessage(&proto.WebMessageInfo{
+		Key:     &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		Message: &proto.Message{},
+	})
+
+	placeholder, ok := msg.(PlaceholderMessage)
+	if !ok {
+		t.Fatalf("parsed as %T", msg)
+	}
+	if placeholder.Info.Id != id || placeholder.Info.RemoteJid != remoteJid {
+		t.Errorf("unexpected message info %+v", placeholder.Info)
+	}
+
+	// messages without any message, e.g. stub messages, are no placeholders
+	if msg := parseProtoMessage(&proto.WebMessageInfo{Key: &proto.MessageKey{RemoteJid: &remoteJid, Id: &id}}); msg != nil {
+		t.Errorf("parsed as %T", msg)
+	}
+}
+
+func TestParseNestedQuotedMessage(t *testing.T) {
+	remoteJid, id, quotedId, nestedId := "491234567890@s.whatsapp.net", "ID", "QUOTED", "NESTED"
+	reply, quotedReply, original := "reply", "quoted reply", "original"
+	msg := parseProtoMessage(&proto.WebMessageInfo{
+		Key: &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		Message: &proto.Message{ExtendedTextMessage: &proto.ExtendedTextMessage{
+			Text: &reply,
+			ContextInfo: &proto.ContextInfo{
+				StanzaId: &quotedId,
+				QuotedMessage: []*proto.Message{{ExtendedTextMessage: &proto.ExtendedTextMessage{
+					Text: &quotedReply,
+					ContextInfo: &proto.ContextInfo{
+						StanzaId:      &nestedId,
+						QuotedMessage: []*proto.Message{{Conversation: &original}},
+					},
+				}}},
+			},
+		}},
+	})
+
+	quoted, ok := msg.(TextMessage).Info.QuotedMessage.(TextMessage)
+	if !ok {
+		t.Fatalf("quoted message parsed as %T", msg.(TextMessage).Info.QuotedMessage)
+	}
+	if quoted.Text != quotedReply || quoted.Info.QuotedMessageID != nestedId {
+		t.Errorf("unexpected quoted message %+v", quoted)
+	}
+	if quoted.Info.QuotedMessage != nil {
+		t.Errorf("nested quoted message parsed as %T", quoted.Info.QuotedMessage)
+	}
+}
+
+func TestParseRevokedMessage(t *testing.T) {
+	remoteJid, id, revokedId := "491234567890@s.whatsapp.net", "ID", "REVOKED"
+	msg := parseProtoMessage(&proto.WebMessageInfo{
+		Key: &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		Message: &proto.Message{ProtocolMessage: &proto.ProtocolMessage{
+			Key:  &proto.MessageKey{RemoteJid: &remoteJid, Id: &revokedId},
+			Type: proto.ProtocolMessage_REVOKE.Enum(),
+		}},
+	})
+	if revoked, ok := msg.(RevokedMessage); !ok || revoked.RevokedMessageID != revokedId {
+		t.Errorf("unexpected message %#v", msg)
+	}
+
+	msg = parseProtoMessage(&proto.WebMessageInfo{
+		Key:             &proto.MessageKey{RemoteJid: &remoteJid, Id: &revokedId},
+		MessageStubType: proto.WebMessageInfo_REVOKE.Enum(),
+	})
+	if revoked, ok := msg.(RevokedMessage); !ok || revoked.RevokedMessageID != revokedId {
+		t.Errorf("unexpected message %#v", msg)
+	}
+}
+
+func TestTemplateProtoRoundTrip(t *testing.T) {
+	msg := TemplateMessage{
+		Info:        MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		Namespace:   "namespace",
+		ElementName: "shipping_update",
+		Params:      []string{"Alice", "42"},
+		FallbackLg:  "en",
+		FallbackLc:  "US",
+	}
+
+	parsed, ok := parseProtoMessage(getTemplateProto(msg)).(TemplateMessage)
+	if !ok {
+		t.Fatal("template proto not parsed as TemplateMessage")
+	}
+	parsed.Info = msg.Info
+	if !reflect.DeepEqual(parsed, msg) {
+		t.Errorf("unexpected message %+v", parsed)
+	}
+}
+
+func TestImageCaptionMentions(t *testing.T) {
+	mentioned := "491111111111@s.whatsapp.net"
+	msg := ImageMessage{
+		Info: MessageInfo{
+			RemoteJid:     "123456789-123456789@g.us",
+			MentionedJids: []string{mentioned},
+		},
+		Caption: "@491111111111 see https://example.com",
+	}
+
+	p := getImageProto(msg)
+	if p.GetMessage().GetImageMessage().GetCaption() != msg.Caption {
+		t.Errorf("unexpected caption %q", p.GetMessage().GetImageMessage().GetCaption())
+	}
+
+	parsed := parseProtoMessage(p).(ImageMessage)
+	if !reflect.DeepEqual(parsed.Info.MentionedJids, []string{mentioned}) || parsed.Caption != msg.Caption {
+		t.Errorf("unexpected message %+v", parsed)
+	}
+
+	// text messages without mentions stay plain conversation messages
+	if p := getTextProto(TextMessage{Text: "https://example.com"}); p.GetMessage().GetExtendedTextMessage() != nil {
+		t.Error("text without mentions sent as extended text message")
+	}
+}
+
+func TestBuildProtoDoesNotUpload(t *testing.T) {
+	wac := &Conn{}
+	p, err := wac.BuildProto(ImageMessage{
+		Info:    MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		Caption: "caption",
+		Type:    "image/jpeg",
+		Content: strings.NewReader("image"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.GetKey().GetId() == "" || p.GetMessageTimestamp() == 0 {
+		t.Errorf("invalid message key %v", p.GetKey())
+	}
+	img := p.GetMessage().GetImageMessage()
+	if img.GetCaption() != "caption" || img.GetUrl() != "" || img.GetMediaKey() != nil {
+		t.Errorf("unexpected image message %v", img)
+	}
+}
+
+func TestContactsArrayProtoRoundTrip(t *testing.T) {
+	msg := ContactsArrayMessage{
+		Info:        MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		DisplayName: "3 contacts",
+		Contacts: []ContactMessage{
+			{DisplayName: "Alice", Vcard: "BEGIN:VCARD\nVERSION:3.0\nFN:Alice\nTEL;type=CELL;waid=491111111111:+49 1111 111111\nEND:VCARD"},
+			{DisplayName: "Bob", Vcard: "BEGIN:VCARD\nVERSION:3.0\nFN:Bob\nEND:VCARD"},
+			{DisplayName: "Carol", Vcard: "BEGIN:VCARD\r\nVERSION:2.1\r\nN:;Carol;;;\r\nEND:VCARD"},
+		},
+	}
+
+	parsed, ok := parseProtoMessage(getContactsArrayProto(msg)).(ContactsArrayMessage)
+	if !ok {
+		t.Fatal("contacts array proto not parsed as ContactsArrayMessage")
+	}
+	parsed.Info = msg.Info
+	if !reflect.DeepEqual(parsed, msg) {
+		t.Errorf("unexpected message %+v", parsed)
+	}
+}
+
+func BenchmarkGetTextProto(b *testing.B) {
+	msg := TextMessage{
+		Info: MessageInfo{
+			RemoteJid: "491234567890@s.whatsapp.net",
+		},
+		Text: "Hello Whatsapp",
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		getTextProto(msg)
+	}
+}
+
+func TestSetMessageIdFormat(t *testing.T) {
+	wac := &Conn{}
+	if err := wac.SetMessageIdFormat("3EB0", 16); err != nil {
+		t.Fatal(err)
+	}
+	if id := wac.newMessageId(); !regexp.MustCompile("^3EB0[0-9A-F]{32}$").MatchString(id) {
+		t.Errorf("invalid message id %q", id)
+	}
+
+	if err := wac.SetMessageIdFormat("3eb0", 16); err == nil {
+		t.Error("lowercase prefix accepted")
+	}
+	if err := wac.SetMessageIdFormat("", 4); err == nil {
+		t.Error("short id accepted")
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	remoteJid, id, text := "491234567890@s.whatsapp.net", "ID", "hello"
+	msg := parseProtoMessage(&proto.WebMessageInfo{
+		Key:     &proto.MessageKey{RemoteJid: &remoteJid, Id: &id},
+		Message: &proto.Message{Conversation: &text},
+	})
+
+	dump := DebugDump(msg)
+	for _, s := range []string{"whatsapp.TextMessage", "Id:ID", `conversation: "hello"`} {
+		if !strings.Contains(dump, s) {
+			t.Errorf("dump does not contain %q:\n%s", s, dump)
+		}
+	}
+	if strings.Contains(dump, "status") {
+		t.Errorf("dump contains unset fields:\n%s", dump)
+	}
+}
+
+func TestBuildProtoMonotonicTimestamp(t *testing.T) {
+	wac := &Conn{}
+
+	// a burst is strictly increasing and stays at most MaxTimestampLead ahead of the clock
+	var last uint64
+	for i := 0; i < 50; i++ {
+		p, err := wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"}, Text: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := p.GetMessageTimestamp()
+		if ts <= last {
+			t.Fatalf("timestamp of message %d is %d, not after %d", i, ts, last)
+		}
+		if max := time.Now().Add(defaultMaxTimestampLead).Unix(); ts > uint64(max) {
+			t.Fatalf("timestamp of message %d is %d, more than %v ahead", i, ts, defaultMaxTimestampLead)
+		}
+		last = ts
+	}
+
+	ts := uint64(1500000000)
+	p, err := wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net", Timestamp: ts}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetMessageTimestamp() != ts {
+		t.Errorf("explicit timestamp %d was replaced with %d", ts, p.GetMessageTimestamp())
+	}
+}
+
+func TestBuildProtoTimestampLead(t *testing.T) {
+	wac := &Conn{MaxTimestampLead: time.Second}
+	msg := TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"}, Text: "hi"}
+
+	// the next timestamp would be two seconds ahead
+	wac.lastTimestamp = uint64(time.Now().Unix()) + 1
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := wac.buildProto(ctx, msg, false); err != context.DeadlineExceeded {
+		t.Fatalf("building a message beyond the lead returned %v", err)
+	}
+
+	last := wac.lastTimestamp
+	p, err := wac.BuildProto(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := p.GetMessageTimestamp(); ts <= last || ts > uint64(time.Now().Add(time.Second).Unix()) {
+		t.Errorf("timestamp %d not after %d or too far ahead", ts, last)
+	}
+}
+
+func TestBuildProtoQuote(t *testing.T) {
+	chat, quotedText := "491234567890@s.whatsapp.net", "original"
+	quoted := TextMessage{
+		Info: MessageInfo{Id: "QUOTED", RemoteJid: chat, Source: &proto.WebMessageInfo{
+			Message: &proto.Message{Conversation: &quotedText},
+		}},
+		Text: quotedText,
+	}
+
+	p, err := (&Conn{}).BuildProto(TextMessage{
+		Info: MessageInfo{RemoteJid: chat, QuotedMessageID: "QUOTED", QuotedMessage: quoted},
+		Text: "reply",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := p.GetMessage().GetExtendedTextMessage().GetContextInfo()
+	if ctx.GetStanzaId() != "QUOTED" || ctx.GetParticipant() != chat {
+		t.Errorf("unexpected quote %q by %q", ctx.GetStanzaId(), ctx.GetParticipant())
+	}
+	if len(ctx.GetQuotedMessage()) != 1 || ctx.GetQuotedMessage()[0].GetConversation() != quotedText {
+		t.Errorf("unexpected quoted message %v", ctx.GetQuotedMessage())
+	}
+
+	reply, ok := parseProtoMessage(p).(TextMessage)
+	if !ok {
+		t.Fatalf("reply parsed as %T", parseProtoMessage(p))
+	}
+	if reply.Info.QuotedMessageID != "QUOTED" || reply.Info.QuotedParticipant != chat {
+		t.Errorf("unexpected quote info %+v", reply.Info)
+	}
+	if q, ok := reply.Info.QuotedMessage.(TextMessage); !ok || q.Text != quotedText {
+		t.Errorf("unexpected quoted message %#v", reply.Info.QuotedMessage)
+	}
+}
+
+func TestBuildProtoQuoteParticipant(t *testing.T) {
+	chat, group, own := "491234567890@s.whatsapp.net", "123456789-1234567890@g.us", "491111111111@s.whatsapp.net"
+	wac := &Conn{session: &Session{Wid: "491111111111@c.us"}}
+
+	for _, tc := range []struct {
+		name        string
+		info        MessageInfo
+		participant string
+	}{
+		{"received in chat", MessageInfo{RemoteJid: chat, QuotedMessageID: "Q",
+			QuotedMessage: TextMessage{Info: MessageInfo{RemoteJid: chat, SenderJid: chat}}}, chat},
+		{"own in chat", MessageInfo{RemoteJid: chat, QuotedMessageID: "Q",
+			QuotedMessage: TextMessage{Info: MessageInfo{RemoteJid: chat, FromMe: true}}}, own},
+		{"own in group", MessageInfo{RemoteJid: group, QuotedMessageID: "Q",
+			QuotedMessage: TextMessage{Info: MessageInfo{RemoteJid: group, FromMe: true}}}, own},
+		{"received in group", MessageInfo{RemoteJid: group, QuotedMessageID: "Q",
+			QuotedMessage: TextMessage{Info: MessageInfo{RemoteJid: group, SenderJid: chat}}}, chat},
+		{"id only in chat", MessageInfo{RemoteJid: chat, QuotedMessageID: "Q"}, chat},
+		{"explicit in group", MessageInfo{RemoteJid: group, QuotedMessageID: "Q", QuotedParticipant: chat}, chat},
+	} {
+		p, err := wac.BuildProto(TextMessage{Info: tc.info, Text: "reply"})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if participant := p.GetMessage().GetExtendedTextMessage().GetContextInfo().GetParticipant(); participant != tc.participant {
+			t.Errorf("%s: quoted participant %q, expected %q", tc.name, participant, tc.participant)
+		}
+	}
+
+	if _, err := wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: group, QuotedMessageID: "Q"}, Text: "reply"}); err == nil {
+		t.Error("quote in group without author accepted")
+	}
+}
+
+func TestBuildProtoRaw(t *testing.T) {
+	remoteJid, text := "491234567890@s.whatsapp.net", "raw"
+	p, err := (&Conn{}).BuildProto(&proto.WebMessageInfo{
+		Key:     &proto.MessageKey{RemoteJid: &remoteJid},
+		Message: &proto.Message{Conversation: &text},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.GetKey().GetId()) < 2 || p.GetMessageTimestamp() == 0 || !p.GetKey().GetFromMe() {
+		t.Errorf("missing id, timestamp or fromMe in %v", p)
+	}
+}
+
+func TestTextProtoLinkPreview(t *testing.T) {
+	msg := TextMessage{
+		Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		Text: "see https://example.com",
+		LinkPreview: &LinkPreview{
+			MatchedText:  "https://example.com",
+			CanonicalUrl: "https://example.com/",
+			Title:        "Example",
+			Thumbnail:    []byte{0xff, 0xd8},
+		},
+	}
+
+	p := getTextProto(msg)
+	if p.GetMessage().GetExtendedTextMessage().GetTitle() != "Example" {
+		t.Fatalf("link preview not sent: %v", p.GetMessage())
+	}
+
+	parsed, ok := parseProtoMessage(p).(TextMessage)
+	if !ok {
+		t.Fatalf("text proto parsed as %T", parseProtoMessage(p))
+	}
+	if parsed.Text != msg.Text || !reflect.DeepEqual(parsed.LinkPreview, msg.LinkPreview) {
+		t.Errorf("unexpected link preview %+v", parsed.LinkPreview)
+	}
+
+	if parsed := parseProtoMessage(getTextProto(TextMessage{Text: "plain"})).(TextMessage); parsed.LinkPreview != nil {
+		t.Errorf("link preview for plain text: %+v", parsed.LinkPreview)
+	}
+}
+
+func TestBuildProtoLocation(t *testing.T) {
+	wac := &Conn{}
+	msg := LocationMessage{
+		Info:             MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		DegreesLatitude:  52.52,
+		DegreesLongitude: 13.405,
+		Name:             "Berlin",
+	}
+
+	p, err := wac.BuildProto(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := parseProtoMessage(p).(LocationMessage)
+	if !ok || parsed.DegreesLatitude != msg.DegreesLatitude || parsed.DegreesLongitude != msg.DegreesLongitude ||
+		parsed.Name != msg.Name {
+		t.Errorf("unexpected location %+v", parseProtoMessage(p))
+	}
+
+	for _, c := range [][2]float64{{91, 0}, {-90.5, 0}, {0, 180.1}, {0, -200}, {math.NaN(), 0}, {0, math.Inf(1)}} {
+		msg.DegreesLatitude, msg.DegreesLongitude = c[0], c[1]
+		if _, err := wac.BuildProto(msg); err == nil {
+			t.Errorf("no error for coordinates %v", c)
+		}
+	}
+}
+
+func TestBuildProtoLiveLocationUpdate(t *testing.T) {
+	wac := &Conn{}
+	msg := LiveLocationMessage{
+		Info:             MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"},
+		DegreesLatitude:  52.52,
+		DegreesLongitude: 13.405,
+		Caption:          "on my way",
+	}
+
+	first, err := wac.BuildProto(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg.Info.Id = first.GetKey().GetId()
+	msg.DegreesLatitude, msg.SequenceNumber = 52.53, 1
+	update, err := wac.BuildProto(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.GetKey().GetId() != first.GetKey().GetId() {
+		t.Errorf("update has id %q instead of %q", update.GetKey().GetId(), first.GetKey().GetId())
+	}
+
+	parsed, ok := parseProtoMessage(update).(LiveLocationMessage)
+	if !ok || parsed.DegreesLatitude != 52.53 || parsed.SequenceNumber != 1 || parsed.Caption != msg.Caption {
+		t.Errorf("unexpected live location %+v", parseProtoMessage(update))
+	}
+}
+
+func TestVideoProtoGifPlayback(t *testing.T) {
+	for _, gif := range []bool{false, true} {
+		p := getVideoProto(VideoMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"}, GifPlayback: gif})
+		if parsed := parseProtoMessage(p).(VideoMessage); parsed.GifPlayback != gif {
+			t.Errorf("gif playback %v parsed as %v", gif, parsed.GifPlayback)
+		}
+	}
+}
+
+func TestMessageIDGenerator(t *testing.T) {
+	wac := &Conn{}
+	if id := wac.newMessageId(); !regexp.MustCompile("^[0-9A-F]{20}$").MatchString(id) {
+		t.Errorf("unexpected default id %q", id)
+	}
+
+	wac.MessageIDGenerator = func() string { return "BOT1" }
+	p, err := wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"}, Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetKey().GetId() != "BOT1" {
+		t.Errorf("generator not used, id %q", p.GetKey().GetId())
+	}
+}
+
+func TestTextProtoStatus(t *testing.T) {
+	p := getTextProto(TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net"}, Text: "hi"})
+	if p.GetStatus() != proto.WebMessageInfo_PENDING {
+		t.Errorf("message without status sent as %v", p.GetStatus())
+	}
+
+	p = getTextProto(TextMessage{Info: MessageInfo{RemoteJid: "491234567890@s.whatsapp.net", Status: Read}, Text: "hi"})
+	if p.GetStatus() != proto.WebMessageInfo_READ || parseProtoMessage(p).(TextMessage).Info.Status != Read {
+		t.Errorf("status %v not kept", p.GetStatus())
+	}
+}
+
+func TestPushName(t *testing.T) {
+	wac := &Conn{}
+	p, err := wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "123456789-1234567890@g.us"}, Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.PushName != nil {
+		t.Errorf("push name %q sent without PushName", p.GetPushName())
+	}
+
+	wac.PushName = "Alice"
+	p, err = wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "123456789-1234567890@g.us"}, Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPushName() != "Alice" {
+		t.Errorf("push name %q, expected Alice", p.GetPushName())
+	}
+
+	p, err = wac.BuildProto(TextMessage{Info: MessageInfo{RemoteJid: "123456789-1234567890@g.us", PushName: "Bob"}, Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPushName() != "Bob" {
+		t.Errorf("push name of the message replaced by %q", p.GetPushName())
+	}
+
+	p, err = wac.BuildProto(&proto.WebMessageInfo{Message: &proto.Message{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPushName() != "Alice" {
+		t.Errorf("push name %q of raw proto, expected Alice", p.GetPushName())
+	}
+}
+
+func TestSenderJid(t *testing.T) {
+	info := func(remoteJid, participant string, fromMe bool) *proto.WebMessageInfo {
+		key := &proto.MessageKey{RemoteJid: &remoteJid, FromMe: &fromMe}
+		if participant != "" {
+			key.Participant = &participant
+		}
+		return &proto.WebMessageInfo{Key: key}
+	}
+
+	for _, tc := range []struct {
+		msg    *proto.WebMessageInfo
+		sender string
+	}{
+		{info("123456789-1234567890@g.us", "491234567890@c.us", false), "491234567890@s.whatsapp.net"},
+		{info("491234567890@s.whatsapp.net", "", false), "491234567890@s.whatsapp.net"},
+		{info("491234567890@s.whatsapp.net", "", true), ""},
+		{info("123456789-1234567890@g.us", "", true), ""},
+		{info("123456789-1234567890@g.us", "", false), ""},
+	} {
+		if sender := getMessageInfo(tc.msg).SenderJid; sender != tc.sender {
+			t.Errorf("sender of %v is %q, expected %q", tc.msg.GetKey(), sender, tc.sender)
+		}
+	}
+}
+
+func TestSendWaitsWithContext(t *testing.T) {
+	wac := &Conn{}
+	wac.SetMaxInFlightSends(1, false)
+	release, err := wac.acquireInFlightSend(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := wac.acquireInFlightSend(ctx); err != context.DeadlineExceeded {
+		t.Errorf("waiting for a free slot returned %v", err)
+	}
+	release()
+	if n := wac.InFlightSends(); n != 0 {
+		t.Errorf("%d sends in flight", n)
+	}
+
+	jid := "491234567890@s.whatsapp.net"
+	first, err := wac.enqueueSend(context.Background(), jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := wac.enqueueSend(ctx, jid); err != context.DeadlineExceeded {
+		t.Errorf("waiting for the earlier send returned %v", err)
+	}
+
+	// the send queued after the cancelled one still has to wait for the first
+	third := make(chan struct{})
+	go func() {
+		release, err := wac.enqueueSend(context.Background(), jid)
+		if err == nil {
+			release()
+		}
+		close(third)
+	}()
+	select {
+	case <-third:
+		t.Fatal("send did not wait for the earlier send")
+	case <-time.After(10 * time.Millisecond):
+	}
+	first()
+	select {
+	case <-third:
+	case <-time.After(time.Second):
+		t.Fatal("send still waiting after the earlier sends are done")
+	}
+}
+
+func TestGetSenderPlatform(t *testing.T) {
+	for id, platform := range map[string]Platform{
+		"3A1B2C3D4E5F60718293":             PlatformIOS,
+		"3EB0123456789ABCDEF012":           PlatformWeb,
+		"0123456789ABCDEF0123456789ABCDEF": PlatformAndroid,
+		"0123456789ABCDEF01":               PlatformDesktop,
+		"ABCDEF":                           PlatformUnknown,
+	} {
+		if got := GetSenderPlatform(id); got != platform {
+			t.Errorf("platform of %q is %q, expected %q", id, got, platform)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if id := generateMessageId(); GetSenderPlatform(id) != PlatformUnknown {
+			t.Fatalf("generated id %q attributed to %q", id, GetSenderPlatform(id))
+		}
+	}
+
+	// formats of other connections do not hide the platform of client ids
+	wac := &Conn{}
+	if err := wac.SetMessageIdFormat("3EB0", 9); err != nil {
+		t.Fatal(err)
+	}
+	if id := wac.newMessageId(); len(id) != 22 || !strings.HasPrefix(id, "3EB0") {
+		t.Errorf("unexpected id %q", id)
+	}
+	if p := GetSenderPlatform("3EB0123456789ABCDEF012"); p != PlatformWeb {
+		t.Errorf("web id attributed to %q", p)
+	}
+}
+
+func TestOrderedSends(t *testing.T) {
+	wac, srv := newTestConn(t, nil)
+	defer srv.close()
+	wac.SetOrderedSends(true)
+
+	// the second message goes to the same chat by its legacy address and waits for the response to the first
+	errs := make(chan error, 2)
+	go func() {
+		errs <- wac.Send(TextMessage{Info: MessageInfo{Id: "FIRST", RemoteJid: "491111111111@s.whatsapp.net"}, Text: "1"})
+	}()
+	srv.waitFrames(1)
+	go func() {
+		errs <- wac.Send(TextMessage{Info: MessageInfo{Id: "SECOND", RemoteJid: "491111111111@c.us"}, Text: "2"})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if frames := srv.received(); len(frames) != 1 || frames[0].tag != "FIRST" {
+		t.Fatalf("second message written before the response to the first: %+v", frames)
+	}
+
+	srv.answer("FIRST", `{"status":200}`)
+	if frames := srv.waitFrames(2); frames[1].tag != "SECOND" {
+		t.Fatalf("unexpected frame %+v", frames[1])
+	}
+	srv.answer("SECOND", `{"status":200}`)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	// sends to other chats do not wait
+	release, err := wac.enqueueSend(context.Background(), "491111111111@s.whatsapp.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := wac.enqueueSend(ctx, "492222222222@s.whatsapp.net")
+	if err != nil {
+		t.Fatalf("send to another chat waited: %v", err)
+	}
+	other()
+
+	// a cancelled send keeps its place, the sends after it wait for the sends before it
+	cancelled, cancel := context.WithCancel(context.Background())
+	queued := make(chan error)
+	go func() {
+		_, err := wac.enqueueSend(cancelled, "491111111111@c.us")
+		queued <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-queued; err != context.Canceled {
+		t.Fatalf("cancelled send returned %v", err)
+	}
+	third := make(chan struct{})
+	go func() {
+		if release, err := wac.enqueueSend(context.Background(), "491111111111@s.whatsapp.net"); err == nil {
+			release()
+		}
+		close(third)
+	}()
+	select {
+	case <-third:
+		t.Fatal("send overtook an earlier send")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-third:
+	case <-time.After(time.Second):
+		t.Fatal("send still waiting after the earlier sends are done")
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	respond := func(f testFrame) interface{} {
+		if f.tag == "REJECTED" {
+			return `{"status":500}`
+		}
+		return `{"status":200}`
+	}
+	wac, srv := newTestConn(t, respond)
+	defer srv.close()
+
+	jid := "491111111111@s.whatsapp.net"
+	ids, err := wac.SendBatch([]interface{}{
+		TextMessage{Info: MessageInfo{Id: "FIRST", RemoteJid: jid}, Text: "1"},
+		TextMessage{Info: MessageInfo{Id: "SECOND", RemoteJid: jid}, Text: "2"},
+		TextMessage{Info: MessageInfo{Id: "REJECTED", RemoteJid: jid}, Text: "3"},
+		TextMessage{Info: MessageInfo{Id: "NOT_SENT", RemoteJid: jid}, Text: "4"},
+	})
+	if !reflect.DeepEqual(ids, []string{"FIRST", "SECOND"}) {
+		t.Errorf("unexpected ids %q", ids)
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 2 || batchErr.Total != 4 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Code != 500 || sendErr.MessageID != "REJECTED" {
+		t.Errorf("send error not found in %v", err)
+	}
+	if frames := srv.received(); len(frames) != 3 {
+		t.Errorf("%d messages written after the error", len(frames)-3)
+	}
+}
+
+func TestAutoPresence(t *testing.T) {
+	wac, srv := newTestConn(t, nil)
+	defer srv.close()
+	wac.AutoPresence = true
+	wac.AutoPresenceDelay, wac.AutoPresenceMaxDelay = 0, 0
+
+	jid := "491111111111@s.whatsapp.net"
+	errs := make(chan error)
+	go func() {
+		errs <- wac.Send(TextMessage{Info: MessageInfo{Id: "MESSAGE", RemoteJid: jid}, Text: "hi"})
+	}()
+
+	// the paused presence is written before the server acknowledged the message
+	frames := srv.waitFrames(3)
+	presence := func(f testFrame) string {
+		if f.node == nil {
+			return ""
+		}
+		for _, n := range childNodes(*f.node) {
+			if n.Description == "presence" && normalizeJid(n.Attributes["to"]) == jid {
+				return n.Attributes["type"]
+			}
+		}
+		return ""
+	}
+	if presence(frames[0]) != string(PresenceComposing) || frames[1].tag != "MESSAGE" || presence(frames[2]) != string(PresencePaused) {
+		t.Errorf("unexpected frames %+v", frames)
+	}
+
+	srv.answer("MESSAGE", `{"status":200}`)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if frames := srv.received(); len(frames) != 3 {
+		t.Errorf("unexpected frames after the response %+v", frames[3:])
+	}
+}
+
+func TestSendMiddleware(t *testing.T) {
+	errRejected := errors.New("rejected")
+	appendText := func(calls *[]string, name string) SendMiddleware {
+		return func(msg interface{}) (interface{}, error) {
+			*calls = append(*calls, name)
+			m := msg.(TextMessage)
+			m.Text += name
+			return m, nil
+		}
+	}
+	reject := func(calls *[]string) SendMiddleware {
+		return func(msg interface{}) (interface{}, error) {
+			*calls = append(*calls, "reject")
+			return nil, errRejected
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		middleware func(calls *[]string) []SendMiddleware
+		text       string
+		err        error
+		calls      []string
+	}{
+		{"none", func(calls *[]string) []SendMiddleware { return nil }, "hi", nil, nil},
+		{"chain", func(calls *[]string) []SendMiddleware {
+			return []SendMiddleware{appendText(calls, "1"), appendText(calls, "2")}
+		}, "hi12", nil, []string{"1", "2"}},
+		{"reject", func(calls *[]string) []SendMiddleware {
+			return []SendMiddleware{appendText(calls, "1"), reject(calls), appendText(calls, "2")}
+		}, "", errRejected, []string{"1", "reject"}},
+	} {
+		var calls []string
+		wac := &Conn{}
+		for _, m := range tc.middleware(&calls) {
+			wac.AddSendMiddleware(m)
+		}
+
+		msg, err := wac.applySendMiddleware(TextMessage{Text: "hi"})
+		if err != tc.err {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if text, _ := msg.(TextMessage); err == nil && text.Text != tc.text {
+			t.Errorf("%s: unexpected text %q", tc.name, text.Text)
+		}
+		if !reflect.DeepEqual(calls, tc.calls) {
+			t.Errorf("%s: unexpected calls %v", tc.name, calls)
+		}
+	}
+
+	// Send writes the transformed message and nothing for rejected messages
+	wac, srv := newTestConn(t, func(f testFrame) interface{} {
+		return `{"status":200}`
+	})
+	defer srv.close()
+	var calls []string
+	wac.AddSendMiddleware(appendText(&calls, "!"))
+	wac.AddSendMiddleware(func(msg interface{}) (interface{}, error) {
+		if msg.(TextMessage).Text == "reject!" {
+			return nil, errRejected
+		}
+		return msg, nil
+	})
+
+	jid := "491111111111@s.whatsapp.net"
+	if err := wac.Send(TextMessage{Info: MessageInfo{Id: "ID", RemoteJid: jid}, Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := parseProtoMessage(wac.Store.getMessage(jid, "ID")).(TextMessage); m.Text != "hi!" {
+		t.Errorf("unexpected sent message %+v", m)
+	}
+	if err := wac.Send(TextMessage{Info: MessageInfo{RemoteJid: jid}, Text: "reject"}); err != errRejected {
+		t.Errorf("unexpected error %v", err)
+	}
+	if frames := srv.received(); len(frames) != 1 {
+		t.Errorf("rejected message written: %+v", frames)
+	}
+}
@@ -0,0 +1,102 @@
+package whatsapp
+
+import (
+	"fmt"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	pb "github.com/golang/protobuf/proto"
+)
+
+/*
+Outbox persists the messages Send has not delivered yet, e.g. in a database, so they can be resent with RetryOutbox
+after a restart. Messages are stored as encoded protos under a key made of the chat and the message id, as message ids
+are only unique within a chat. Add has to overwrite a message that is already stored under the same key. The methods
+may be called concurrently.
+*/
+type Outbox interface {
+	Add(key string, data []byte) error
+	Remove(key string) error
+	List() ([][]byte, error)
+}
+
+/*
+SetOutbox sets the Outbox of the connection. Send adds every message to the outbox before it is written to the server
+and removes it when the server acknowledged it. Media is uploaded before, the outbox only stores the reference to the
+uploaded media, which stays available on the WhatsApp servers for some time. Messages that are still in the outbox after
+a crash are sent again by RetryOutbox. Delivery is at-least-once: a message may have reached the server just before
+the crash and is sent a second time then. Resent messages keep their message id, which allows receivers to detect
+the duplicates. Messages the server rejects are removed from the outbox, the rejection is returned by Send as
+SendError. Setting nil disables the outbox, which is the default.
+*/
+func (wac *Conn) SetOutbox(outbox Outbox) {
+	wac.outboxMutex.Lock()
+	defer wac.outboxMutex.Unlock()
+	wac.outbox = outbox
+}
+
+func (wac *Conn) getOutbox() Outbox {
+	wac.outboxMutex.RLock()
+	defer wac.outboxMutex.RUnlock()
+	return wac.outbox
+}
+
+/*
+RetryOutbox resends all messages that are still in the outbox. It should be called after login. Messages the server
+rejects are removed from the outbox, messages that fail otherwise, e.g. because of a timeout, stay in the outbox. The
+first error is returned after all messages were tried.
+*/
+func (wac *Conn) RetryOutbox() error {
+	outbox := wac.getOutbox()
+	if outbox == nil {
+		return nil
+	}
+
+	pending, err := outbox.List()
+	if err != nil {
+		return fmt.Errorf("error listing outbox: %v", err)
+	}
+
+	var firstErr error
+	for _, data := range pending {
+		p := &proto.WebMessageInfo{}
+		if err = pb.Unmarshal(data, p); err != nil {
+			err = fmt.Errorf("error decoding outbox message: %v", err)
+		} else {
+			err = wac.Send(p)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// outboxKey returns the key of p in the outbox.
+func outboxKey(p *proto.WebMessageInfo) string {
+	return p.GetKey().GetRemoteJid() + "/" + p.GetKey().GetId()
+}
+
+func (wac *Conn) addToOutbox(p *proto.WebMessageInfo) error {
+	outbox := wac.getOutbox()
+	if outbox == nil {
+		return nil
+	}
+
+	data, err := pb.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("error encoding outbox message: %v", err)
+	}
+	if err = outbox.Add(outboxKey(p), data); err != nil {
+		return fmt.Errorf("error adding message to outbox: %v", err)
+	}
+	return nil
+}
+
+func (wac *Conn) removeFromOutbox(p *proto.WebMessageInfo) {
+	outbox := wac.getOutbox()
+	if outbox == nil {
+		return
+	}
+
+	// the message was delivered or rejected, if it can not be removed it is only sent again by RetryOutbox
+	outbox.Remove(outboxKey(p))
+}
@@ -0,0 +1,94 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"sync"
+	"testing"
+)
+
+// memoryOutbox is an Outbox that keeps the messages in memory.
+type memoryOutbox struct {
+	sync.Mutex
+	messages map[string][]byte
+}
+
+func (o *memoryOutbox) Add(key string, data []byte) error {
+	o.Lock()
+	defer o.Unlock()
+	o.messages[key] = data
+	return nil
+}
+
+func (o *memoryOutbox) Remove(key string) error {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.messages, key)
+	return nil
+}
+
+func (o *memoryOutbox) List() ([][]byte, error) {
+	o.Lock()
+	defer o.Unlock()
+	var list [][]byte
+	for _, data := range o.messages {
+		list = append(list, data)
+	}
+	return list, nil
+}
+
+func (o *memoryOutbox) len() int {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.messages)
+}
+
+func TestOutbox(t *testing.T) {
+	outbox := &memoryOutbox{messages: map[string][]byte{}}
+	wac := &Conn{Store: newStore()}
+	wac.SetOutbox(outbox)
+
+	build := func(remoteJid string) *proto.WebMessageInfo {
+		p, err := wac.BuildProto(TextMessage{Info: MessageInfo{Id: "ID", RemoteJid: remoteJid}, Text: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// the same id in different chats does not collide
+	delivered, rejected := build("491234567890@s.whatsapp.net"), build("491111111111@s.whatsapp.net")
+	for _, p := range []*proto.WebMessageInfo{delivered, rejected} {
+		if err := wac.addToOutbox(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outbox.len() != 2 {
+		t.Fatalf("outbox has %d messages, expected 2", outbox.len())
+	}
+
+	if _, err := wac.handleSendResponse(delivered, `{"status":200}`); err != nil {
+		t.Fatal(err)
+	}
+	if outbox.len() != 1 {
+		t.Errorf("delivered message not removed from the outbox")
+	}
+
+	_, err := wac.handleSendResponse(rejected, `{"status":400}`)
+	if sendErr, ok := err.(*SendError); !ok || sendErr.Code != 400 || sendErr.MessageID != "ID" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if outbox.len() != 0 {
+		t.Errorf("rejected message not removed from the outbox")
+	}
+
+	// messages that can not be sent stay in the outbox
+	if err := wac.addToOutbox(build("491234567890@s.whatsapp.net")); err != nil {
+		t.Fatal(err)
+	}
+	if err := wac.RetryOutbox(); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+	if outbox.len() != 1 {
+		t.Errorf("failed message removed from the outbox")
+	}
+}
@@ -0,0 +1,168 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Rhymen/go-whatsapp/binary"
+	"strconv"
+	"time"
+)
+
+/*
+PrivacySetting is one of the privacy settings of the account.
+*/
+type PrivacySetting string
+
+const (
+	// PrivacyLastSeen controls who sees when the account was last online. Allowed values: all, contacts, none.
+	PrivacyLastSeen PrivacySetting = "last"
+	// PrivacyProfilePhoto controls who sees the profile photo. Allowed values: all, contacts, none.
+	PrivacyProfilePhoto PrivacySetting = "profile"
+	// PrivacyStatus controls who sees the about text. Allowed values: all, contacts, none.
+	PrivacyStatus PrivacySetting = "status"
+	// PrivacyReadReceipts controls whether read receipts are sent and received. Allowed values: all, none.
+	PrivacyReadReceipts PrivacySetting = "readreceipts"
+)
+
+/*
+PrivacyValue is the audience of a privacy setting.
+*/
+type PrivacyValue string
+
+const (
+	PrivacyEveryone PrivacyValue = "all"
+	PrivacyContacts PrivacyValue = "contacts"
+	PrivacyNobody   PrivacyValue = "none"
+)
+
+/*
+PrivacySettings are the privacy settings of the account as returned by GetPrivacySettings. Settings the server did not
+return are empty.
+*/
+type PrivacySettings struct {
+	LastSeen     PrivacyValue
+	ProfilePhoto PrivacyValue
+	Status       PrivacyValue
+	ReadReceipts PrivacyValue
+}
+
+/*
+GetPrivacySettings queries the privacy settings of the account.
+*/
+func (wac *Conn) GetPrivacySettings() (*PrivacySettings, error) {
+	node, err := wac.query("privacy", "", "", "", "", "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error querying privacy settings: %v", err)
+	}
+
+	settings := parsePrivacySettings(node)
+
+	wac.privacyMutex.Lock()
+	wac.privacySettings = *settings
+	wac.privacyMutex.Unlock()
+
+	return settings, nil
+}
+
+// parsePrivacySettings returns the settings of a privacy response.
+func parsePrivacySettings(node *binary.Node) *PrivacySettings {
+	settings := &PrivacySettings{}
+	for _, c := range getPrivacyCategories(node) {
+		value := PrivacyValue(c.Attributes["value"])
+		switch PrivacySetting(c.Attributes["name"]) {
+		case PrivacyLastSeen:
+			settings.LastSeen = value
+		case PrivacyProfilePhoto:
+			settings.ProfilePhoto = value
+		case PrivacyStatus:
+			settings.Status = value
+		case PrivacyReadReceipts:
+			settings.ReadReceipts = value
+		}
+	}
+	return settings
+}
+
+// getPrivacyCategories returns the category nodes of a privacy response, which are either the content of the
+// response itself or of a privacy node inside of it.
+func getPrivacyCategories(node *binary.Node) []binary.Node {
+	children, ok := node.Content.([]binary.Node)
+	if !ok {
+		return nil
+	}
+
+	var categories []binary.Node
+	for _, c := range children {
+		switch c.Description {
+		case "category":
+			categories = append(categories, c)
+		case "privacy":
+			categories = append(categories, getPrivacyCategories(&c)...)
+		}
+	}
+	return categories
+}
+
+/*
+SetPrivacySetting changes a privacy setting of the account. See the PrivacySetting constants for the values every
+setting allows.
+*/
+func (wac *Conn) SetPrivacySetting(setting PrivacySetting, value PrivacyValue) error {
+	if value != PrivacyEveryone && value != PrivacyNobody && (value != PrivacyContacts || setting == PrivacyReadReceipts) {
+		return fmt.Errorf("invalid value %q for privacy setting %q", value, setting)
+	}
+
+	ts := time.Now().Unix()
+	tag := fmt.Sprintf("%d.--%d", ts, wac.msgCount)
+
+	n := binary.Node{
+		Description: "action",
+		Attributes: map[string]string{
+			"type":  "set",
+			"epoch": strconv.Itoa(wac.msgCount),
+		},
+		Content: []interface{}{binary.Node{
+			Description: "privacy",
+			Content: []binary.Node{{
+				Description: "category",
+				Attributes: map[string]string{
+					"name":  string(setting),
+					"value": string(value),
+				},
+			}},
+		}},
+	}
+
+	ch, err := wac.writeBinary(n, group, ignore, tag)
+	if err != nil {
+		return fmt.Errorf("error setting privacy: %v", err)
+	}
+
+	select {
+	case r := <-ch:
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &resp); err != nil {
+			return fmt.Errorf("error decoding privacy response: %v", err)
+		}
+		if status, ok := resp["status"].(float64); ok && int(status) != 200 {
+			return fmt.Errorf("setting privacy responded with %d", int(status))
+		}
+	case <-time.After(wac.msgTimeout):
+		return fmt.Errorf("setting privacy timed out")
+	}
+
+	if setting == PrivacyReadReceipts {
+		wac.privacyMutex.Lock()
+		wac.privacySettings.ReadReceipts = value
+		wac.privacyMutex.Unlock()
+	}
+	return nil
+}
+
+// readReceiptsDisabled reports whether the account is known to have read receipts disabled, from the last
+// GetPrivacySettings or SetPrivacySetting call.
+func (wac *Conn) readReceiptsDisabled() bool {
+	wac.privacyMutex.RLock()
+	defer wac.privacyMutex.RUnlock()
+	return wac.privacySettings.ReadReceipts == PrivacyNobody
+}
@@ -0,0 +1,52 @@
+package whatsapp
+
+import (
+	"github.com/Rhymen/go-whatsapp/binary"
+	"testing"
+)
+
+func privacyCategory(name, value string) binary.Node {
+	return binary.Node{Description: "category", Attributes: map[string]string{"name": name, "value": value}}
+}
+
+func TestParsePrivacySettings(t *testing.T) {
+	expected := PrivacySettings{
+		LastSeen:     PrivacyContacts,
+		ProfilePhoto: PrivacyEveryone,
+		Status:       PrivacyNobody,
+		ReadReceipts: PrivacyEveryone,
+	}
+
+	// the categories are either the content of the response or of a privacy node inside of it
+	for _, node := range []*binary.Node{
+		{Description: "response", Content: []binary.Node{
+			privacyCategory("last", "contacts"),
+			privacyCategory("profile", "all"),
+			privacyCategory("status", "none"),
+			privacyCategory("readreceipts", "all"),
+		}},
+		{Description: "response", Content: []binary.Node{{
+			Description: "privacy",
+			Content: []binary.Node{
+				privacyCategory("last", "contacts"),
+				privacyCategory("profile", "all"),
+				privacyCategory("status", "none"),
+				privacyCategory("readreceipts", "all"),
+				privacyCategory("groupadd", "contacts"),
+			},
+		}}},
+	} {
+		if settings := parsePrivacySettings(node); *settings != expected {
+			t.Errorf("unexpected settings %+v", settings)
+		}
+	}
+
+	// settings the server did not return stay empty
+	node := &binary.Node{Description: "response", Content: []binary.Node{privacyCategory("last", "none")}}
+	if settings := parsePrivacySettings(node); *settings != (PrivacySettings{LastSeen: PrivacyNobody}) {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if settings := parsePrivacySettings(&binary.Node{Description: "response"}); *settings != (PrivacySettings{}) {
+		t.Errorf("unexpected settings of empty response %+v", settings)
+	}
+}
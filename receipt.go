@@ -0,0 +1,90 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+	ReceiptPlayed    = "played"
+)
+
+/*
+ReceiptMessage is a delivery or read receipt of a sent message. Info identifies the message the receipt belongs to:
+RemoteJid is the chat, SenderJid the member of a group that received or read the message and Info.Status the new
+status of the message. Status is one of ReceiptDelivered, ReceiptRead and ReceiptPlayed (for audio messages). Receipts
+of messages that were not sent on this connection are dispatched as well.
+*/
+type ReceiptMessage struct {
+	Info   MessageInfo
+	Status string
+}
+
+// GetInfo returns the MessageInfo of the message the receipt belongs to.
+func (m ReceiptMessage) GetInfo() MessageInfo {
+	return m.Info
+}
+
+// receiptStatus maps the ack values of WhatsApp Web to the receipt status. Acks of the server (1) and lower are no
+// receipts of the recipient.
+var receiptStatus = map[int]string{
+	2: ReceiptDelivered,
+	3: ReceiptRead,
+	4: ReceiptPlayed,
+}
+
+// parseReceiptJson parses the ack json messages of the forms ["Msg", {"cmd": "ack", "id": ..., ...}] for a single
+// message and ["MsgInfo", {"cmd": "ack", "id": [...], ...}] for several messages.
+func parseReceiptJson(msg string) ([]ReceiptMessage, bool) {
+	if !strings.HasPrefix(msg, `["Msg"`) && !strings.HasPrefix(msg, `["MsgInfo"`) {
+		return nil, false
+	}
+
+	var data []json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &data); err != nil || len(data) < 2 {
+		return nil, false
+	}
+
+	var ack struct {
+		Cmd         string          `json:"cmd"`
+		Id          json.RawMessage `json:"id"`
+		Ack         int             `json:"ack"`
+		From        string          `json:"from"`
+		Participant string          `json:"participant"`
+		T           uint64          `json:"t"`
+	}
+	if err := json.Unmarshal(data[1], &ack); err != nil || ack.Cmd != "ack" {
+		return nil, false
+	}
+	status, ok := receiptStatus[ack.Ack]
+	if !ok {
+		return nil, false
+	}
+
+	var ids []string
+	if err := json.Unmarshal(ack.Id, &ids); err != nil {
+		var id string
+		if err := json.Unmarshal(ack.Id, &id); err != nil || id == "" {
+			return nil, false
+		}
+		ids = []string{id}
+	}
+
+	receipts := make([]ReceiptMessage, 0, len(ids))
+	for _, id := range ids {
+		receipts = append(receipts, ReceiptMessage{
+			Info: MessageInfo{
+				Id:        id,
+				RemoteJid: normalizeJid(ack.From),
+				SenderJid: normalizeJid(ack.Participant),
+				FromMe:    true,
+				Timestamp: ack.T,
+				Status:    MessageStatus(ack.Ack + 1),
+			},
+			Status: status,
+		})
+	}
+	return receipts, len(receipts) > 0
+}
@@ -0,0 +1,34 @@
+package whatsapp
+
+import "testing"
+
+func TestParseReceiptJson(t *testing.T) {
+	receipts, ok := parseReceiptJson(`["Msg",{"cmd":"ack","id":"3EB0ABC","ack":2,"from":"491234567890@c.us","to":"499876543210@c.us","t":1500000000}]`)
+	if !ok || len(receipts) != 1 {
+		t.Fatalf("unexpected receipts %+v", receipts)
+	}
+	r := receipts[0]
+	if r.Status != ReceiptDelivered || r.Info.Id != "3EB0ABC" || r.Info.RemoteJid != "491234567890@s.whatsapp.net" ||
+		r.Info.Status != DeliveryAck || r.Info.Timestamp != 1500000000 {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+
+	receipts, ok = parseReceiptJson(`["MsgInfo",{"cmd":"ack","id":["A1","A2"],"ack":3,"from":"123-456@g.us","participant":"491234567890@c.us"}]`)
+	if !ok || len(receipts) != 2 {
+		t.Fatalf("unexpected receipts %+v", receipts)
+	}
+	if receipts[1].Status != ReceiptRead || receipts[1].Info.Id != "A2" ||
+		receipts[1].Info.SenderJid != "491234567890@s.whatsapp.net" || receipts[1].Info.Status != Read {
+		t.Errorf("unexpected receipt %+v", receipts[1])
+	}
+
+	for _, msg := range []string{
+		`["Msg",{"cmd":"ack","id":"A1","ack":1,"from":"491234567890@c.us"}]`,
+		`["Msg",{"cmd":"acks","id":"A1","ack":2,"from":"491234567890@c.us"}]`,
+		`["Presence",{"id":"491234567890@c.us","type":"available"}]`,
+	} {
+		if _, ok := parseReceiptJson(msg); ok {
+			t.Errorf("%s parsed as receipt", msg)
+		}
+	}
+}
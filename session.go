@@ -178,6 +178,9 @@ func (wac *Conn) Login(qrChan chan<- string) (Session, error) {
 	info := resp2[1].(map[string]interface{})
 
 	wac.Info = newInfoFromReq(info)
+	if wac.PushName == "" {
+		wac.PushName = wac.Info.Pushname
+	}
 
 	session.ClientToken = info["clientToken"].(string)
 	session.ServerToken = info["serverToken"].(string)
@@ -226,6 +229,7 @@ func (wac *Conn) Login(qrChan chan<- string) (Session, error) {
 	session.EncKey = keyDecrypted[:32]
 	session.MacKey = keyDecrypted[32:64]
 	wac.session = &session
+	wac.setLoggedIn(true)
 
 	return session, nil
 }
@@ -334,11 +338,15 @@ func (wac *Conn) RestoreSession(session Session) (Session, error) {
 	info := connResp[1].(map[string]interface{})
 
 	wac.Info = newInfoFromReq(info)
+	if wac.PushName == "" {
+		wac.PushName = wac.Info.Pushname
+	}
 
 	//set new tokens
 	session.ClientToken = info["clientToken"].(string)
 	session.ServerToken = info["serverToken"].(string)
 	session.Wid = info["wid"].(string)
+	wac.setLoggedIn(true)
 
 	return *wac.session, nil
 }
@@ -384,6 +392,7 @@ func (wac *Conn) Logout() error {
 	if err != nil {
 		return fmt.Errorf("error writing logout: %v\n", err)
 	}
+	wac.setLoggedIn(false)
 
 	return nil
 }
@@ -2,11 +2,26 @@ package whatsapp
 
 import (
 	"github.com/Rhymen/go-whatsapp/binary"
-	"strings"
+	"github.com/Rhymen/go-whatsapp/binary/proto"
+	"sync"
 )
 
+// messageStoreSize is the number of messages kept by the Store.
+const messageStoreSize = 1000
+
+/*
+Store contains data WhatsApp sends about the account. Besides the contacts it keeps the last 1000 messages received or
+sent on the connection in memory, they can be looked up with Conn.GetMessage.
+*/
 type Store struct {
 	Contacts map[string]Contact
+
+	messages      map[string]*proto.WebMessageInfo
+	messageKeys   []string
+	messagesMutex sync.RWMutex
+
+	blocked      map[string]bool
+	blockedMutex sync.RWMutex
 }
 
 type Contact struct {
@@ -18,7 +33,9 @@ type Contact struct {
 
 func newStore() *Store {
 	return &Store{
-		make(map[string]Contact),
+		Contacts: make(map[string]Contact),
+		messages: make(map[string]*proto.WebMessageInfo),
+		blocked:  make(map[string]bool),
 	}
 }
 
@@ -34,7 +51,7 @@ func (wac *Conn) updateContacts(contacts interface{}) {
 			continue
 		}
 
-		jid := strings.Replace(contactNode.Attributes["jid"], "@c.us", "@s.whatsapp.net", 1)
+		jid := normalizeJid(contactNode.Attributes["jid"])
 		wac.Store.Contacts[jid] = Contact{
 			jid,
 			contactNode.Attributes["notify"],
@@ -43,3 +60,68 @@ func (wac *Conn) updateContacts(contacts interface{}) {
 		}
 	}
 }
+
+func messageStoreKey(remoteJid, id string) string {
+	return normalizeJid(remoteJid) + "/" + id
+}
+
+func (s *Store) addMessage(msg *proto.WebMessageInfo) {
+	key := messageStoreKey(msg.GetKey().GetRemoteJid(), msg.GetKey().GetId())
+
+	s.messagesMutex.Lock()
+	defer s.messagesMutex.Unlock()
+
+	if _, ok := s.messages[key]; !ok {
+		if len(s.messageKeys) == messageStoreSize {
+			delete(s.messages, s.messageKeys[0])
+			s.messageKeys = s.messageKeys[1:]
+		}
+		s.messageKeys = append(s.messageKeys, key)
+	}
+	s.messages[key] = msg
+}
+
+func (s *Store) getMessage(remoteJid, id string) *proto.WebMessageInfo {
+	s.messagesMutex.RLock()
+	defer s.messagesMutex.RUnlock()
+	return s.messages[messageStoreKey(remoteJid, id)]
+}
+
+// setBlocklist replaces the blocked contacts with jids.
+func (s *Store) setBlocklist(jids []string) {
+	blocked := make(map[string]bool, len(jids))
+	for _, jid := range jids {
+		blocked[normalizeJid(jid)] = true
+	}
+
+	s.blockedMutex.Lock()
+	s.blocked = blocked
+	s.blockedMutex.Unlock()
+}
+
+func (s *Store) setBlocked(jid string, blocked bool) {
+	s.blockedMutex.Lock()
+	defer s.blockedMutex.Unlock()
+	if blocked {
+		s.blocked[normalizeJid(jid)] = true
+	} else {
+		delete(s.blocked, normalizeJid(jid))
+	}
+}
+
+func (s *Store) isBlocked(jid string) bool {
+	s.blockedMutex.RLock()
+	defer s.blockedMutex.RUnlock()
+	return s.blocked[normalizeJid(jid)]
+}
+
+func (s *Store) getBlocklist() []string {
+	s.blockedMutex.RLock()
+	defer s.blockedMutex.RUnlock()
+
+	jids := make([]string, 0, len(s.blocked))
+	for jid := range s.blocked {
+		jids = append(jids, jid)
+	}
+	return jids
+}
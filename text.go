@@ -0,0 +1,121 @@
+package whatsapp
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+SplitText splits s into parts that are at most maxLen bytes long. Parts are preferably split at line breaks, then at
+other whitespace. Split points inside a formatted span (*bold*, _italic_, ~strikethrough~ or a ```monospace``` block)
+are avoided if possible, so the formatting is not broken across messages. If a part has no whitespace at all it is cut
+at the last rune boundary, multi-byte characters are never split. Whitespace at the split points is dropped.
+*/
+func SplitText(s string, maxLen int) []string {
+	if maxLen <= 0 || len(s) <= maxLen {
+		return []string{s}
+	}
+
+	var parts []string
+	for len(s) > maxLen {
+		cut := textSplitPoint(s, maxLen)
+		if part := strings.TrimRightFunc(s[:cut], unicode.IsSpace); part != "" {
+			parts = append(parts, part)
+		}
+		s = strings.TrimLeftFunc(s[cut:], unicode.IsSpace)
+	}
+	if s != "" {
+		parts = append(parts, s)
+	}
+
+	return parts
+}
+
+// textSplitPoint returns the index at which the first part of s is cut. It scans the first maxLen bytes once, keeping
+// track of the formatted spans, and picks the last whitespace outside of them. A line break is preferred over later
+// spaces if it is in the back half of the part, so a line break at the start does not produce a tiny part.
+func textSplitPoint(s string, maxLen int) int {
+	newline, space := -1, -1
+	fences, opened := 0, 0
+	open := map[rune]bool{}
+	prev := ' '
+	for i := 0; i <= maxLen; {
+		// monospace blocks may span multiple lines, all other markers only apply within a single line
+		if strings.HasPrefix(s[i:], "```") {
+			fences++
+			prev = '`'
+			i += 3
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if i > 0 && isSplitSpace(s[i]) && fences%2 == 0 && opened == 0 {
+			if r == '\n' {
+				newline = i
+			} else {
+				space = i
+			}
+		}
+
+		switch r {
+		case '\n':
+			open = map[rune]bool{}
+			opened = 0
+		case '*', '_', '~':
+			next, _ := utf8.DecodeRuneInString(s[i+size:])
+			if !open[r] && unicode.IsSpace(prev) && next != utf8.RuneError && !unicode.IsSpace(next) {
+				open[r] = true
+				opened++
+			} else if open[r] && !unicode.IsSpace(prev) {
+				open[r] = false
+				opened--
+			}
+		}
+		prev = r
+		i += size
+	}
+
+	if newline >= maxLen/2 {
+		return newline
+	}
+	if space < newline {
+		space = newline
+	}
+	if space > 0 {
+		return space
+	}
+
+	// no safe whitespace, fall back to the last rune boundary
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		_, cut = utf8.DecodeRuneInString(s)
+	}
+	return cut
+}
+
+func isSplitSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
+
+/*
+SendLongText sends the text of msg split into parts of at most maxLen bytes, see SplitText. The parts are sent one
+after another, every part waits for the server response of the previous one. Every part gets its own message id, an id
+set in msg.Info is ignored. Sending stops at the first error.
+*/
+func (wac *Conn) SendLongText(msg TextMessage, maxLen int) error {
+	parts := SplitText(msg.Text, maxLen)
+	for i, text := range parts {
+		part := msg
+		part.Info.Id = ""
+		part.Text = text
+		if err := wac.Send(part); err != nil {
+			return fmt.Errorf("sending part %d of %d failed: %v", i+1, len(parts), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package whatsapp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplitTextShort(t *testing.T) {
+	parts := SplitText("hello world", 20)
+	if !reflect.DeepEqual(parts, []string{"hello world"}) {
+		t.Errorf("unexpected parts: %q", parts)
+	}
+}
+
+func TestSplitTextPrefersLineBreaks(t *testing.T) {
+	parts := SplitText("first line\nsecond line here", 20)
+	if !reflect.DeepEqual(parts, []string{"first line", "second line here"}) {
+		t.Errorf("unexpected parts: %q", parts)
+	}
+}
+
+func TestSplitTextEarlyLineBreak(t *testing.T) {
+	s := "a\n" + strings.Repeat("word ", 1000)
+	parts := SplitText(s, 4096)
+	if len(parts) != 2 || len(parts[0]) < 4000 {
+		t.Errorf("unexpected parts of %d and %d bytes", len(parts[0]), len(parts[len(parts)-1]))
+	}
+}
+
+func TestSplitTextLarge(t *testing.T) {
+	s := strings.Repeat("some *bold* and _italic_ text\n", 7000)
+	start := time.Now()
+	parts := SplitText(s, 4096)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("splitting %d bytes took %v", len(s), d)
+	}
+	if strings.TrimSpace(strings.Join(parts, "\n")) != strings.TrimSpace(s) {
+		t.Error("text changed by splitting")
+	}
+}
+
+func TestSplitTextRuneSafe(t *testing.T) {
+	s := strings.Repeat("ä", 10)
+	parts := SplitText(s, 5)
+	if strings.Join(parts, "") != s {
+		t.Errorf("text changed by splitting: %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 5 || !utf8.ValidString(p) {
+			t.Errorf("invalid part: %q", p)
+		}
+	}
+}
+
+func TestSplitTextFormatting(t *testing.T) {
+	parts := SplitText("some *bold text* end", 14)
+	if !reflect.DeepEqual(parts, []string{"some", "*bold text*", "end"}) {
+		t.Errorf("unexpected parts: %q", parts)
+	}
+
+	parts = SplitText("a\n```\ncode\n```\nb", 13)
+	if !reflect.DeepEqual(parts, []string{"a", "```\ncode\n```", "b"}) {
+		t.Errorf("unexpected parts: %q", parts)
+	}
+}